@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"spiderlite/internal/crawler"
+	"spiderlite/internal/database"
+	"spiderlite/internal/metrics"
+)
+
+// Exit codes of the check command.
+const (
+	exitPassed = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+// threshold is one of the conditions checked after a crawl: the broken
+// links it found of a given kind, and how many are tolerated.
+type threshold struct {
+	name string
+	// max is the number of broken links allowed, or negative for no limit.
+	max    int
+	broken []database.BrokenLink
+}
+
+func (t threshold) passed() bool {
+	return t.max < 0 || len(t.broken) <= t.max
+}
+
+// runCheck crawls a site and fails when its broken links exceed the
+// thresholds: "crawler check [flags] <url>". It returns the exit code.
+func runCheck(args []string) int {
+	// Invalid flags exit with exitError rather than flag's own exit code
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	crawlerFlags := crawler.AddFlags(fs)
+	optionsFlags := crawler.AddOptionsFlags(fs, true)
+	dbPath := fs.String("db", ":memory:", "Path of the database storing the crawl (in memory by default)")
+	maxBroken := fs.Int("max-broken", 0, "Maximum pages and assets answering 4xx/5xx or failing (-1 for no limit)")
+	maxLoops := fs.Int("max-redirect-loops", 0, "Maximum redirect loops (-1 for no limit)")
+	maxExternal := fs.Int("max-external-failures", 0, "Maximum broken external links (-1 for no limit)")
+	format := fs.String("format", "text", "Output format: text or junit")
+	output := fs.String("output", "", "File the summary is written to (standard output by default)")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		log.Printf("Usage: %s check [flags] <url>", os.Args[0])
+		return exitError
+	}
+	if *format != "text" && *format != "junit" {
+		log.Printf("Invalid format: %s", *format)
+		return exitError
+	}
+	startURL, err := url.Parse(fs.Arg(0))
+	if err != nil {
+		log.Printf("Invalid URL: %v", err)
+		return exitError
+	}
+
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return exitError
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := crawler.New(db, metrics.NewNoopMetrics(), crawlerFlags.CrawlerOptions()...)
+	result, err := c.Start(ctx, startURL, optionsFlags.Options())
+	if err != nil {
+		log.Printf("Crawling failed: %v", err)
+		return exitError
+	}
+	if ctx.Err() != nil {
+		log.Printf("Check interrupted")
+		return exitError
+	}
+
+	broken, err := db.GetAllBrokenLinks(result.JobID)
+	if err != nil {
+		log.Printf("Failed to fetch broken links: %v", err)
+		return exitError
+	}
+	thresholds := []threshold{
+		{name: "broken pages", max: *maxBroken},
+		{name: "redirect loops", max: *maxLoops},
+		{name: "external failures", max: *maxExternal},
+	}
+	for _, b := range broken {
+		switch {
+		case b.Checked && !internal(b):
+			thresholds[2].broken = append(thresholds[2].broken, b)
+		case b.ErrorCategory == database.ErrorRedirectLoop:
+			thresholds[1].broken = append(thresholds[1].broken, b)
+		default:
+			thresholds[0].broken = append(thresholds[0].broken, b)
+		}
+	}
+
+	var summary bytes.Buffer
+	if *format == "junit" {
+		err = writeJUnit(&summary, startURL.String(), result, thresholds)
+	} else {
+		err = writeCheckSummary(&summary, startURL.String(), result, thresholds)
+	}
+	if err == nil && *output != "" {
+		err = os.WriteFile(*output, summary.Bytes(), 0644)
+	} else if err == nil {
+		_, err = summary.WriteTo(os.Stdout)
+	}
+	if err != nil {
+		log.Printf("Failed to write summary: %v", err)
+		return exitError
+	}
+
+	for _, t := range thresholds {
+		if !t.passed() {
+			return exitFailed
+		}
+	}
+	return exitPassed
+}
+
+// internal reports whether a broken link points to one of the crawled hosts.
+func internal(b database.BrokenLink) bool {
+	return len(b.Sources) > 0 && b.Sources[0].Internal
+}
+
+// writeCheckSummary writes the outcome of each threshold as plain text,
+// followed by PASS or FAIL.
+func writeCheckSummary(w io.Writer, startURL string, result *crawler.Result, thresholds []threshold) error {
+	_, err := fmt.Fprintf(w, "Crawled %d pages from %s in %s (job %d, %s)\n",
+		result.Pages, startURL, result.Duration.Round(time.Millisecond), result.JobID, result.StopReason)
+	if err != nil {
+		return err
+	}
+
+	passed := true
+	for _, t := range thresholds {
+		status := "PASS"
+		if !t.passed() {
+			status, passed = "FAIL", false
+		}
+		if _, err := fmt.Fprintf(w, "%s %s: %d (%s)\n", status, t.name, len(t.broken), describeMax(t.max)); err != nil {
+			return err
+		}
+		for _, b := range t.broken {
+			if err := writeBrokenLink(w, "    ", b); err != nil {
+				return err
+			}
+		}
+	}
+
+	if passed {
+		_, err = fmt.Fprintln(w, "PASS")
+	} else {
+		_, err = fmt.Fprintln(w, "FAIL")
+	}
+	return err
+}
+
+func describeMax(max int) string {
+	if max < 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("max %d", max)
+}
+
+// JUnit XML report, as understood by CI servers: one test suite for the
+// crawl, with a test case per threshold.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes the outcome of each threshold as a JUnit XML report.
+// The broken links of a threshold are listed in its failure, or in its
+// output when they are within the limit.
+func writeJUnit(w io.Writer, startURL string, result *crawler.Result, thresholds []threshold) error {
+	suite := junitTestSuite{
+		Name:  startURL,
+		Tests: len(thresholds),
+		Time:  fmt.Sprintf("%.3f", result.Duration.Seconds()),
+	}
+	for _, t := range thresholds {
+		var details bytes.Buffer
+		for _, b := range t.broken {
+			writeBrokenLink(&details, "", b)
+		}
+
+		tc := junitTestCase{Name: t.name, ClassName: "spiderlite.check"}
+		if t.passed() {
+			tc.SystemOut = details.String()
+		} else {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d %s (%s)", len(t.broken), t.name, describeMax(t.max)),
+				Type:    "threshold",
+				Body:    details.String(),
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+
+	// One broken page, one redirect loop and one broken external link
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<a href="/ok">OK</a>
+				<a href="/missing">Missing</a>
+				<a href="/loop-a">Loop</a>
+				<a href="%[1]s/ok">External</a>
+				<a href="%[1]s/gone">Gone</a>
+			</body></html>`, external.URL)
+		case "/ok":
+			w.Write([]byte(`<html><body></body></html>`))
+		case "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	output := filepath.Join(t.TempDir(), "summary")
+	check := func(args ...string) (int, string) {
+		os.Remove(output)
+		args = append([]string{"-retries=0", "-sitemaps=false", "-output", output}, args...)
+		code := runCheck(args)
+		summary, _ := os.ReadFile(output)
+		return code, string(summary)
+	}
+
+	t.Run("passed", func(t *testing.T) {
+		code, summary := check("-max-broken=1", "-max-redirect-loops=1", "-max-external-failures=1", site.URL+"/")
+		if code != exitPassed {
+			t.Errorf("Expected exit code %d, got %d:\n%s", exitPassed, code, summary)
+		}
+		// Each threshold counts its own broken link
+		for _, line := range []string{
+			"PASS broken pages: 1 (max 1)",
+			"PASS redirect loops: 1 (max 1)",
+			"PASS external failures: 1 (max 1)",
+		} {
+			if !strings.Contains(summary, line+"\n") {
+				t.Errorf("Expected %q in summary:\n%s", line, summary)
+			}
+		}
+		if !strings.HasSuffix(summary, "\nPASS\n") {
+			t.Errorf("Expected the summary to end with PASS:\n%s", summary)
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		code, summary := check("-max-broken=-1", "-max-redirect-loops=-1", "-max-external-failures=-1", site.URL+"/")
+		if code != exitPassed {
+			t.Errorf("Expected exit code %d, got %d:\n%s", exitPassed, code, summary)
+		}
+	})
+
+	t.Run("threshold exceeded", func(t *testing.T) {
+		code, summary := check("-max-broken=1", "-max-redirect-loops=1", site.URL+"/")
+		if code != exitFailed {
+			t.Errorf("Expected exit code %d, got %d:\n%s", exitFailed, code, summary)
+		}
+		if !strings.Contains(summary, "FAIL external failures: 1 (max 0)\n") ||
+			!strings.Contains(summary, external.URL+"/gone") {
+			t.Errorf("Expected the external failure to be reported:\n%s", summary)
+		}
+		if !strings.HasSuffix(summary, "\nFAIL\n") {
+			t.Errorf("Expected the summary to end with FAIL:\n%s", summary)
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		code, summary := check("-format=junit", "-max-broken=1", site.URL+"/")
+		if code != exitFailed {
+			t.Errorf("Expected exit code %d, got %d", exitFailed, code)
+		}
+
+		var report junitTestSuites
+		if err := xml.Unmarshal([]byte(summary), &report); err != nil {
+			t.Fatalf("Invalid JUnit report: %v\n%s", err, summary)
+		}
+		if len(report.Suites) != 1 {
+			t.Fatalf("Expected 1 test suite, got %d", len(report.Suites))
+		}
+		suite := report.Suites[0]
+		if suite.Tests != 3 || suite.Failures != 2 || len(suite.Cases) != 3 {
+			t.Errorf("Expected 3 tests with 2 failures, got tests=%d failures=%d cases=%d",
+				suite.Tests, suite.Failures, len(suite.Cases))
+		}
+		failed := make(map[string]bool)
+		for _, tc := range suite.Cases {
+			failed[tc.Name] = tc.Failure != nil
+		}
+		want := map[string]bool{"broken pages": false, "redirect loops": true, "external failures": true}
+		for name, wantFailed := range want {
+			if failed[name] != wantFailed {
+				t.Errorf("Expected failed=%v for %s, got %v", wantFailed, name, failed[name])
+			}
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"no url", nil},
+			{"invalid format", []string{"-format=xml", site.URL + "/"}},
+			{"unknown flag", []string{"-no-such-flag", site.URL + "/"}},
+			{"invalid url", []string{"%zz"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if code := runCheck(tt.args); code != exitError {
+					t.Errorf("Expected exit code %d, got %d", exitError, code)
+				}
+			})
+		}
+	})
+}
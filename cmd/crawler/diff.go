@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"spiderlite/internal/database"
+)
+
+// runDiff prints what changed between two crawl jobs:
+// "crawler diff [flags] <from-job> <to-job>".
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	dbPath := fs.String("db", "crawler.db", "Path of the crawl database")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		log.Fatalf("Usage: %s diff [flags] <from-job> <to-job>", os.Args[0])
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Invalid format: %s", *format)
+	}
+	var ids [2]int64
+	for i := range ids {
+		id, err := strconv.ParseInt(fs.Arg(i), 10, 64)
+		if err != nil || id <= 0 {
+			log.Fatalf("Invalid job: %s", fs.Arg(i))
+		}
+		ids[i] = id
+	}
+
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	diff, err := db.DiffCrawls(ids[0], ids[1])
+	if errors.Is(err, database.ErrNotFound) {
+		log.Fatalf("Crawl job not found")
+	}
+	if err != nil {
+		log.Fatalf("Failed to compare crawls: %v", err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+	} else {
+		err = writeDiff(os.Stdout, diff)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write diff: %v", err)
+	}
+}
+
+// writeDiff writes a plain text crawl diff, with a section per kind of
+// change.
+func writeDiff(w io.Writer, diff *database.CrawlDiff) error {
+	var lines []string
+	section := func(name string, entries []string) {
+		lines = append(lines, fmt.Sprintf("%s: %d", name, len(entries)))
+		for _, entry := range entries {
+			lines = append(lines, "    "+entry)
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("Crawl %d -> %d", diff.From, diff.To))
+	section("Added", snapshotEntries(diff.Added))
+	section("Removed", snapshotEntries(diff.Removed))
+	section("Status changed", changeEntries(diff.StatusChanged, false))
+	section("Redirect changed", changeEntries(diff.RedirectChanged, false))
+	section("Title changed", changeEntries(diff.TitleChanged, true))
+	section("New broken", changeEntries(diff.NewBroken, false))
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func snapshotEntries(snapshots []database.PageSnapshot) []string {
+	entries := make([]string, len(snapshots))
+	for i, s := range snapshots {
+		entries[i] = fmt.Sprintf("%s %s", s.Status(), s.URL)
+	}
+	return entries
+}
+
+// changeEntries describes each change as "URL: from -> to", with the values
+// quoted when quote is set.
+func changeEntries(changes []database.PageChange, quote bool) []string {
+	entries := make([]string, len(changes))
+	for i, c := range changes {
+		from, to := c.From, c.To
+		if quote {
+			from, to = strconv.Quote(from), strconv.Quote(to)
+		} else if from == "" {
+			from = "(not crawled)"
+		}
+		entries[i] = fmt.Sprintf("%s: %s -> %s", c.URL, from, to)
+	}
+	return entries
+}
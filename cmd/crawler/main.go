@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"spiderlite/internal/crawler"
 	"spiderlite/internal/database"
@@ -11,10 +15,29 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatalf("Usage: %s <url>", os.Args[0])
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		}
 	}
-	startURL := os.Args[1]
+
+	crawlerFlags := crawler.AddFlags(flag.CommandLine)
+	optionsFlags := crawler.AddOptionsFlags(flag.CommandLine, false)
+	history := flag.Int("history", database.DefaultHistoryRetention, "Snapshots of each page kept across crawls (0 to keep all)")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalf("Usage: %s [flags] <url>\n       %s check [flags] <url>\n       %s report broken [flags]\n       %s diff [flags] <from-job> <to-job>",
+			os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+	}
+	startURL := flag.Arg(0)
 
 	parsedURL, err := url.Parse(startURL)
 	if err != nil {
@@ -34,12 +57,27 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetHistoryRetention(*history)
 
 	// Create crawler instance with metrics
-	c := crawler.New(db, metrics)
+	c := crawler.New(db, metrics, crawlerFlags.CrawlerOptions()...)
 
-	// Start crawling
-	if err := c.Start(parsedURL); err != nil {
+	// Stop crawling gracefully on Ctrl-C, keeping the job queued so the
+	// next run with the same URL resumes it
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		cancel(crawler.ErrShutdown)
+	}()
+
+	// Start crawling, or resume the interrupted crawl of the URL
+	result, err := c.ResumeOrStart(ctx, parsedURL, optionsFlags.Options())
+	if err != nil {
 		log.Fatalf("Crawling failed: %v", err)
 	}
+	log.Printf("Crawl job %d stopped (%s): %d pages in %s", result.JobID, result.StopReason, result.Pages, result.Duration)
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"spiderlite/internal/crawler"
+	"spiderlite/internal/database"
+	"spiderlite/internal/metrics"
+)
+
+// runReport prints a report on the crawled pages: "crawler report broken".
+func runReport(args []string) {
+	if len(args) < 1 || args[0] != "broken" {
+		log.Fatalf("Usage: %s report broken [flags]", os.Args[0])
+	}
+
+	fs := flag.NewFlagSet("report broken", flag.ExitOnError)
+	dbPath := fs.String("db", "crawler.db", "Path of the crawl database")
+	jobID := fs.Int64("job", 0, "Only report the pages and links of this crawl job")
+	format := fs.String("format", "text", "Output format: text or json")
+	checkExternal := fs.Bool("check-external", false, "Check the external links that were not crawled before reporting")
+	checkAssets := fs.Bool("check-assets", false, "Check the images, scripts and other assets before reporting")
+	workers := fs.Int("workers", crawler.DefaultWorkers, "Number of links checked concurrently")
+	userAgent := fs.String("user-agent", crawler.DefaultUserAgent, "User-Agent header sent with every check")
+	requestTimeout := fs.Duration("request-timeout", crawler.DefaultRequestTimeout, "Timeout of each check")
+	fs.Parse(args[1:])
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Invalid format: %s", *format)
+	}
+
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if *checkExternal || *checkAssets {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		c := crawler.New(db, metrics.NewNoopMetrics(),
+			crawler.WithWorkers(*workers),
+			crawler.WithUserAgent(*userAgent),
+			crawler.WithRequestTimeout(*requestTimeout),
+		)
+		if *checkExternal {
+			n, err := c.CheckExternalLinks(ctx, *jobID)
+			if err != nil {
+				log.Fatalf("Checking external links failed: %v", err)
+			}
+			log.Printf("Checked %d external links", n)
+		}
+		if *checkAssets {
+			n, err := c.CheckAssets(ctx, *jobID)
+			if err != nil {
+				log.Fatalf("Checking assets failed: %v", err)
+			}
+			log.Printf("Checked %d assets", n)
+		}
+	}
+
+	broken, err := db.GetBrokenLinks(*jobID)
+	if err != nil {
+		log.Fatalf("Failed to fetch broken links: %v", err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(map[string]interface{}{
+			"count":  len(broken),
+			"broken": broken,
+		})
+	} else {
+		err = writeBrokenLinks(os.Stdout, broken)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+// writeBrokenLinks writes a plain text broken link report, listing each
+// broken URL with the pages linking to it.
+func writeBrokenLinks(w io.Writer, broken []database.BrokenLink) error {
+	for _, b := range broken {
+		if err := writeBrokenLink(w, "", b); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d broken links\n", len(broken))
+	return err
+}
+
+// writeBrokenLink writes a broken URL and the pages linking to it, each line
+// starting with indent.
+func writeBrokenLink(w io.Writer, indent string, b database.BrokenLink) error {
+	line := fmt.Sprintf("%s%s %s", indent, brokenStatus(b), b.URL)
+	if b.Checked && !internal(b) {
+		line += " (external)"
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+	for _, link := range b.Sources {
+		if _, err := fmt.Fprintf(w, "%s    linked from %s %q\n", indent, link.SourceURL, link.AnchorText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// brokenStatus describes why a link is broken: its error category or its
+// status code.
+func brokenStatus(b database.BrokenLink) string {
+	if b.ErrorCategory != "" {
+		return b.ErrorCategory
+	}
+	return strconv.Itoa(b.StatusCode)
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"spiderlite/internal/crawler"
 	"spiderlite/internal/database"
 	"spiderlite/internal/metrics"
 	"spiderlite/internal/server"
+	"syscall"
+	"time"
 )
 
 func main() {
 	addr := flag.String("addr", ":8080", "HTTP server address")
+	crawlerFlags := crawler.AddFlags(flag.CommandLine)
+	history := flag.Int("history", database.DefaultHistoryRetention, "Snapshots of each page kept across crawls (0 to keep all)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "Time allowed for requests and crawls to stop on shutdown")
+	flag.Parse()
+
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "/data/crawler.db" // default path
@@ -24,6 +34,7 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetHistoryRetention(*history)
 
 	// Initialize metrics
 	metrics, err := metrics.New()
@@ -33,9 +44,33 @@ func main() {
 	defer metrics.Close()
 
 	// Create and start server
-	srv := server.New(db, metrics)
-	log.Printf("Starting server on %s", *addr)
-	if err := srv.Start(*addr); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := server.New(db, metrics, crawlerFlags.CrawlerOptions()...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", *addr)
+		errCh <- srv.Start(*addr)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			// log.Fatalf skips deferred calls
+			metrics.Close()
+			db.Close()
+			log.Fatalf("Server error: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Received shutdown signal")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown incomplete: %v", err)
 	}
+	log.Printf("Server stopped")
 }
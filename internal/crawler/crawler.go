@@ -1,11 +1,14 @@
 package crawler
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"spiderlite/internal/database"
@@ -13,126 +16,739 @@ import (
 	"spiderlite/internal/parser"
 )
 
+// DefaultWorkers is the number of fetch workers used when none is configured.
+const DefaultWorkers = 8
+
+// DefaultRequestTimeout bounds each page request when none is configured.
+const DefaultRequestTimeout = 10 * time.Second
+
+// DefaultMaxBodySize caps the size of the page bodies read when no cap is
+// configured.
+const DefaultMaxBodySize = 10 << 20
+
+// Default crawler identity, sent as the User-Agent header and matched
+// against robots.txt groups.
+const (
+	DefaultUserAgent   = "spiderlite/1.0 (+https://github.com/emmlejeail/spiderlite)"
+	DefaultRobotsToken = "spiderlite"
+)
+
 type Crawler struct {
 	db      *database.DB
 	metrics metrics.MetricsClient
-	visited map[string]bool
 	client  *http.Client
+	workers int
+	limiter *hostLimiter
+
+	minDelay       time.Duration
+	maxHostConns   int
+	userAgent      string
+	robotsToken    string
+	requestTimeout time.Duration
+	retries        int
+	retryBackoff   time.Duration
+	maxBodySize    int64
+	maxRedirects   int
+	normalizer     parser.Normalizer
+	notifier       Notifier
+
+	mu      sync.Mutex
+	running map[int64]*runningJob
+	wg      sync.WaitGroup
+}
+
+// Option configures a Crawler.
+type Option func(*Crawler)
+
+// WithWorkers sets the number of pages fetched concurrently during a crawl.
+func WithWorkers(n int) Option {
+	return func(c *Crawler) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithMinDelay sets the minimum delay between two requests to the same host.
+// A longer Crawl-delay from robots.txt takes precedence.
+func WithMinDelay(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d >= 0 {
+			c.minDelay = d
+		}
+	}
+}
+
+// WithMaxHostConns caps the number of concurrent requests to the same host.
+// Zero means no cap beyond the number of workers.
+func WithMaxHostConns(n int) Option {
+	return func(c *Crawler) {
+		if n >= 0 {
+			c.maxHostConns = n
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Crawler) {
+		if ua != "" {
+			c.userAgent = ua
+		}
+	}
+}
+
+// WithRobotsToken sets the product token used to select the robots.txt
+// group that applies to the crawler.
+func WithRobotsToken(token string) Option {
+	return func(c *Crawler) {
+		if token != "" {
+			c.robotsToken = token
+		}
+	}
+}
+
+// WithRequestTimeout bounds the time spent on each page request.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d > 0 {
+			c.requestTimeout = d
+		}
+	}
+}
+
+// WithRetries sets how many times a request failing with a network error,
+// a 429 or a 5xx response is retried. Zero disables retries.
+func WithRetries(n int) Option {
+	return func(c *Crawler) {
+		if n >= 0 {
+			c.retries = n
+		}
+	}
+}
+
+// WithRetryBackoff sets the base delay before the first retry, doubled on
+// each following one and randomized to spread retries out.
+func WithRetryBackoff(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d > 0 {
+			c.retryBackoff = d
+		}
+	}
+}
+
+// WithMaxBodySize caps the size of the page bodies read, in bytes. Larger
+// pages are recorded with a body_too_large error. Zero means no cap.
+func WithMaxBodySize(n int64) Option {
+	return func(c *Crawler) {
+		if n >= 0 {
+			c.maxBodySize = n
+		}
+	}
+}
+
+// WithMaxRedirects sets the number of redirects followed for a page before
+// it is recorded with a too_many_redirects error. Zero disables following
+// redirects, storing the redirect response itself.
+func WithMaxRedirects(n int) Option {
+	return func(c *Crawler) {
+		if n >= 0 {
+			c.maxRedirects = n
+		}
+	}
 }
 
-func New(db *database.DB, m metrics.MetricsClient) *Crawler {
-	return &Crawler{
+// WithStripParams sets the query parameters removed from every crawled URL,
+// as path.Match patterns such as "utm_*". It defaults to
+// parser.DefaultStripParams.
+func WithStripParams(patterns []string) Option {
+	return func(c *Crawler) {
+		c.normalizer.StripParams = patterns
+	}
+}
+
+// WithSortQuery sets whether query parameters are sorted so URLs differing
+// only by parameter order are crawled once. It is enabled by default.
+func WithSortQuery(sort bool) Option {
+	return func(c *Crawler) {
+		c.normalizer.SortQuery = sort
+	}
+}
+
+// Notifier is told about the jobs that completed or failed. JobFinished is
+// called from the goroutine running the job, so it should not block.
+type Notifier interface {
+	JobFinished(job database.CrawlJob)
+}
+
+// WithNotifier sets the Notifier told about finished jobs.
+func WithNotifier(n Notifier) Option {
+	return func(c *Crawler) {
+		c.notifier = n
+	}
+}
+
+func New(db *database.DB, m metrics.MetricsClient, opts ...Option) *Crawler {
+	c := &Crawler{
 		db:      db,
 		metrics: m,
-		visited: make(map[string]bool),
-		client:  &http.Client{},
+		workers: DefaultWorkers,
+
+		userAgent:      DefaultUserAgent,
+		robotsToken:    DefaultRobotsToken,
+		requestTimeout: DefaultRequestTimeout,
+		retries:        DefaultRetries,
+		retryBackoff:   DefaultRetryBackoff,
+		maxBodySize:    DefaultMaxBodySize,
+		maxRedirects:   DefaultMaxRedirects,
+		normalizer: parser.Normalizer{
+			StripParams: parser.DefaultStripParams,
+			SortQuery:   true,
+		},
+		running: make(map[int64]*runningJob),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.client = &http.Client{
+		Transport:     &userAgentTransport{userAgent: c.userAgent, next: http.DefaultTransport},
+		CheckRedirect: c.checkRedirect,
+	}
+	c.limiter = newHostLimiter(c.minDelay, c.maxHostConns)
+	return c
 }
 
-func (c *Crawler) Start(startURL *url.URL) error {
-	log.Printf("Starting crawl for: %s", startURL.String())
+// Normalize returns u normalized the way crawled URLs are before they are
+// stored.
+func (c *Crawler) Normalize(u *url.URL) *url.URL {
+	return c.normalizer.Normalize(u)
+}
 
-	robots, err := NewRobotsChecker(startURL)
+// Start creates a crawl job for startURL with the given limits and runs it,
+// blocking until the crawl ends or ctx is cancelled.
+func (c *Crawler) Start(ctx context.Context, startURL *url.URL, opts Options) (*Result, error) {
+	jobID, err := c.createJob(startURL, opts)
 	if err != nil {
-		log.Printf("Robots.txt error: %v", err)
-		// Continue anyway
+		return nil, err
 	}
+	return c.Run(ctx, jobID, startURL, opts)
+}
 
-	if !robots.IsAllowed(startURL.Path) {
-		return fmt.Errorf("URL disallowed by robots.txt: %s", startURL)
+// Run runs an existing crawl job, resuming its frontier if the job was
+// interrupted, and records its outcome on the job. Cancelling ctx with
+// ErrPaused as its cause pauses the job, ErrShutdown queues it again, and
+// any other cancellation cancels it.
+func (c *Crawler) Run(ctx context.Context, jobID int64, startURL *url.URL, opts Options) (*Result, error) {
+	return c.runJob(ctx, jobID, startURL, opts, func() {})
+}
+
+// runJob is Run calling stopped once the crawl has stopped, before its
+// outcome is recorded on the job.
+func (c *Crawler) runJob(ctx context.Context, jobID int64, startURL *url.URL, opts Options, stopped func()) (*Result, error) {
+	if err := c.db.StartJob(jobID); err != nil {
+		return nil, fmt.Errorf("failed to start job %d: %v", jobID, err)
+	}
+
+	result, err := c.run(ctx, jobID, startURL, opts)
+	stopped()
+	if err != nil {
+		if err := c.db.FinishJob(jobID, database.JobFailed, "", err.Error()); err != nil {
+			log.Printf("Failed to record failure of job %d: %v", jobID, err)
+		}
+		c.notify(jobID)
+		return nil, err
+	}
+
+	switch result.StopReason {
+	case StopPaused:
+		err = c.db.PauseJob(jobID)
+	case StopInterrupted:
+		err = c.db.RequeueJob(jobID)
+	case StopCancelled:
+		err = c.db.FinishJob(jobID, database.JobCancelled, string(result.StopReason), "")
+	default:
+		err = c.db.FinishJob(jobID, database.JobCompleted, string(result.StopReason), "")
+		if err == nil {
+			c.notify(jobID)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to record outcome of job %d: %v", jobID, err)
 	}
+	return result, nil
+}
 
-	return c.crawl(startURL, robots)
+// notify tells the notifier, if any, that a job finished.
+func (c *Crawler) notify(jobID int64) {
+	if c.notifier == nil {
+		return
+	}
+	job, err := c.db.GetJob(jobID)
+	if err != nil {
+		log.Printf("Failed to load finished job %d: %v", jobID, err)
+		return
+	}
+	c.notifier.JobFinished(*job)
 }
 
-func (c *Crawler) crawl(u *url.URL, robots *RobotsChecker) error {
-	start := time.Now()
-	defer func() {
-		c.metrics.TimeCrawl(time.Since(start), u.Host)
-	}()
+// crawlRun holds the state of one crawl job shared by its workers.
+type crawlRun struct {
+	ctx      context.Context
+	jobID    int64
+	opts     Options
+	scope    *scope
+	frontier *frontier
 
-	if c.visited[u.String()] {
-		return nil
+	mu     sync.Mutex
+	robots map[string]*hostRobots
+}
+
+// hostRobots holds the robots.txt rules of a host, fetched once.
+type hostRobots struct {
+	once   sync.Once
+	robots *RobotsChecker
+}
+
+// robotsFor returns the robots.txt rules of u's host, fetching them and
+// applying their Crawl-delay the first time the host is seen. Only the
+// workers needing the same host wait for the fetch.
+func (c *Crawler) robotsFor(r *crawlRun, u *url.URL) *RobotsChecker {
+	r.mu.Lock()
+	host, ok := r.robots[u.Host]
+	if !ok {
+		host = &hostRobots{}
+		r.robots[u.Host] = host
 	}
-	c.visited[u.String()] = true
+	r.mu.Unlock()
 
-	log.Printf("Crawling: %s", u.String())
+	host.once.Do(func() {
+		robots, err := c.fetchRobots(r.ctx, u)
+		if err != nil {
+			log.Printf("Robots.txt error for %s: %v", u.Host, err)
+			// Continue anyway
+		}
+		if delay := robots.CrawlDelay(); delay > 0 {
+			if delay > maxCrawlDelay {
+				log.Printf("Capping Crawl-delay of %s for %s to %s", delay, u.Host, maxCrawlDelay)
+			} else {
+				log.Printf("Honoring Crawl-delay of %s for %s", delay, u.Host)
+			}
+			c.limiter.setCrawlDelay(u.Host, delay)
+		}
+		host.robots = robots
+	})
+	return host.robots
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (c *Crawler) run(ctx context.Context, jobID int64, startURL *url.URL, opts Options) (*Result, error) {
+	startURL = c.normalizer.Normalize(startURL)
+	log.Printf("Starting crawl job %d for: %s", jobID, startURL.String())
+	started := time.Now()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	scope, err := newScope(startURL, opts)
 	if err != nil {
-		log.Printf("Request error for %s: %v", u.String(), err)
-		return err
+		return nil, err
+	}
+	r := &crawlRun{
+		ctx:    ctx,
+		jobID:  jobID,
+		opts:   opts,
+		scope:  scope,
+		robots: make(map[string]*hostRobots),
 	}
 
-	resp, err := c.client.Do(req)
+	robots := c.robotsFor(r, startURL)
+	if !robots.IsAllowed(startURL.Path) {
+		return nil, fmt.Errorf("URL disallowed by robots.txt: %s", startURL)
+	}
+
+	f, err := c.openFrontier(r, startURL, robots)
+	if err != nil {
+		return nil, err
+	}
+	r.frontier = f
+
+	if opts.MaxDuration > 0 {
+		// Measured from the job's first start, so resuming does not extend it
+		remaining := opts.MaxDuration
+		if job, err := c.db.GetJob(jobID); err == nil && job.StartedAt != nil {
+			remaining -= time.Since(*job.StartedAt)
+		}
+		if remaining <= 0 {
+			f.stop(StopMaxDuration)
+		}
+		timer := time.AfterFunc(remaining, func() {
+			f.stop(StopMaxDuration)
+		})
+		defer timer.Stop()
+	}
+	stopOnCancel := context.AfterFunc(ctx, func() {
+		f.stop(cancelReason(ctx))
+	})
+	defer stopOnCancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(r)
+		}()
+	}
+	wg.Wait()
+
+	result := &Result{
+		JobID:      jobID,
+		Pages:      f.pages(),
+		Duration:   time.Since(started),
+		StopReason: f.stopReason(),
+	}
+	// Paused and interrupted jobs keep their queue so they can be resumed
+	if result.StopReason != StopCompleted && result.StopReason != StopPaused && result.StopReason != StopInterrupted {
+		if err := c.db.SkipQueued(jobID); err != nil {
+			log.Printf("Failed to skip remaining URLs: %v", err)
+		}
+	}
+	// Check links once the job is done with, not when it will be resumed
+	if opts.CheckExternal && ctx.Err() == nil {
+		if _, err := c.CheckExternalLinks(ctx, jobID); err != nil {
+			log.Printf("Failed to check external links of job %d: %v", jobID, err)
+		}
+	}
+	if opts.CheckAssets && ctx.Err() == nil {
+		if _, err := c.CheckAssets(ctx, jobID); err != nil {
+			log.Printf("Failed to check assets of job %d: %v", jobID, err)
+		}
+	}
+
+	log.Printf("Crawl job %d for %s stopped (%s) after %d pages in %s",
+		jobID, startURL.String(), result.StopReason, result.Pages, result.Duration)
+	c.metrics.IncrementCrawlsStopped(string(result.StopReason))
+	return result, nil
+}
+
+// openFrontier returns the frontier of a crawl job. If the job was
+// interrupted, its pending URLs are resumed; otherwise the crawl starts from
+// startURL and the in-scope pages listed in the site's sitemaps.
+func (c *Crawler) openFrontier(r *crawlRun, startURL *url.URL, robots *RobotsChecker) (*frontier, error) {
+	jobID := r.jobID
+	f := newFrontier(c.db, jobID, r.opts.MaxPages)
+
+	pending, err := f.restore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load frontier: %v", err)
+	}
+	if pending > 0 {
+		log.Printf("Resuming crawl job %d with %d pending URLs", jobID, pending)
+		return f, nil
+	}
+
+	f.push(startURL, database.FrontierEntry{Source: database.SourceSeed})
+
+	if !r.opts.SkipSitemaps {
+		var added int
+		for _, entry := range c.discoverSitemapURLs(r.ctx, startURL, robots) {
+			u, err := url.Parse(entry.Loc)
+			if err != nil {
+				continue
+			}
+			u = c.normalizer.Normalize(u)
+			if !r.scope.contains(u) || !c.robotsFor(r, u).IsAllowed(u.Path) {
+				continue
+			}
+			if f.push(u, database.FrontierEntry{
+				Source:   database.SourceSitemap,
+				LastMod:  entry.LastMod,
+				Priority: entry.Priority,
+			}) {
+				added++
+			}
+		}
+		log.Printf("Seeded crawl job %d with %d URLs from sitemaps", jobID, added)
+	}
+	return f, nil
+}
+
+// work processes URLs from the frontier until the crawl is finished.
+func (c *Crawler) work(r *crawlRun) {
+	f := r.frontier
+	for {
+		it, ok := f.pop()
+		if !ok {
+			return
+		}
+		err := c.crawl(r, it)
+		if r.ctx.Err() != nil {
+			// The crawl was interrupted mid-page: put the URL back so a
+			// resumed job fetches it again.
+			f.stop(cancelReason(r.ctx))
+			f.requeue(it.url)
+			continue
+		}
+		if err != nil {
+			log.Printf("Error crawling %s: %v", it.url.String(), err)
+		}
+		f.done(it.url, err != nil)
+		if err := c.db.IncrementJobPages(r.jobID, err != nil); err != nil {
+			log.Printf("Failed to update counters of job %d: %v", r.jobID, err)
+		}
+	}
+}
+
+func (c *Crawler) crawl(r *crawlRun, it item) error {
+	u := it.url
+	start := time.Now()
+	defer func() {
+		c.metrics.TimeCrawl(time.Since(start), u.Host)
+	}()
+
+	log.Printf("Crawling: %s", u.String())
+
+	// Only fetch the page again if it changed since the last crawl
+	cached := c.cachedPage(r, u)
+	trace := &requestTrace{}
+	resp, attempts, err := c.fetch(withTrace(r.ctx, trace), http.MethodGet, u, conditionalHeader(cached))
 	if err != nil {
+		if r.ctx.Err() != nil {
+			return err
+		}
 		c.metrics.IncrementCrawlErrors()
 		log.Printf("HTTP error for %s: %v", u.String(), err)
-		// Store error page
-		if err := c.db.StorePage(database.PageData{
-			URL:        u.String(),
-			StatusCode: 0,
-			CrawledAt:  time.Now(),
-		}); err != nil {
-			log.Printf("Failed to store error page: %v", err)
-		}
+		c.storeError(r, it, attempts, trace, err)
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return c.crawlUnchanged(r, it, cached, attempts, trace, resp)
+	}
 
-	// Store successful page
+	// Links are relative to the URL the page was served from
+	finalURL := resp.Request.URL
 	pageData := database.PageData{
-		URL:        u.String(),
-		StatusCode: resp.StatusCode,
-		CrawledAt:  time.Now(),
+		URL:           u.String(),
+		StatusCode:    resp.StatusCode,
+		CrawledAt:     time.Now(),
+		JobID:         r.jobID,
+		Source:        it.source,
+		Attempts:      attempts,
+		FinalURL:      finalURL.String(),
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: max(resp.ContentLength, 0),
+		ResponseTime:  trace.responseTime,
+		Depth:         it.depth,
+		ParentURL:     it.parent,
+		Headers:       resp.Header,
+		ETag:          resp.Header.Get("ETag"),
+		LastModified:  resp.Header.Get("Last-Modified"),
+	}
+	robots := parser.ParseXRobotsTag(resp.Header.Values("X-Robots-Tag"), c.robotsToken)
+
+	// Read and parse the body before storing the page so its metadata and
+	// a failed read are recorded
+	var doc *parser.Document
+	var readErr error
+	if resp.StatusCode == 200 {
+		var body []byte
+		body, readErr = readBody(resp, c.maxBodySize)
+		if readErr != nil {
+			if r.ctx.Err() != nil {
+				return readErr
+			}
+			c.metrics.IncrementCrawlErrors()
+			log.Printf("Body error for %s: %v", u.String(), readErr)
+			pageData.ErrorCategory = classifyError(readErr)
+			pageData.ErrorMessage = readErr.Error()
+		} else {
+			pageData.ContentLength = int64(len(body))
+		}
+
+		if readErr == nil && isHTML(pageData.ContentType) {
+			doc, err = parser.ParseHTML(bytes.NewReader(body), finalURL)
+			if err != nil {
+				log.Printf("HTML parsing error for %s: %v", u.String(), err)
+			}
+			pageData.Title = doc.Title
+			pageData.Description = doc.Description
+			if doc.Canonical != nil {
+				pageData.CanonicalURL = doc.Canonical.String()
+			}
+			robots = robots.Merge(doc.Robots)
+		}
 	}
+	pageData.NoIndex = robots.NoIndex
+	pageData.NoFollow = robots.NoFollow
 
 	if err := c.db.StorePage(pageData); err != nil {
 		log.Printf("Failed to store page %s: %v", u.String(), err)
 		return err
 	}
+	c.storeRedirects(r, u, trace)
 	log.Printf("Successfully stored page: %s with status: %d", u.String(), resp.StatusCode)
 
 	// Increment pages processed with status code
 	c.metrics.IncrementPagesProcessed(resp.StatusCode, u.Host)
 
+	// Links come from the Link headers of successful responses and the
+	// body of HTML pages. Storing them even when there are none drops the
+	// links found by a previous crawl of the page.
+	var found []parser.Link
+	if resp.StatusCode == 200 && readErr == nil {
+		found = parser.ParseLinkHeader(resp.Header.Values("Link"), finalURL)
+		if doc != nil {
+			found = append(found, doc.Links...)
+		}
+	}
+
+	// Record every HTTP link in the link graph, followed or not. Assets
+	// are only checked on demand.
+	follow := !robots.NoFollow || r.opts.IgnoreNoFollow
+	var links []*url.URL
+	var edges []database.Link
+	for _, link := range found {
+		target := c.normalizer.Normalize(link.URL)
+		if target.Scheme != "http" && target.Scheme != "https" {
+			continue
+		}
+		edges = append(edges, database.Link{
+			TargetURL:  target.String(),
+			AnchorText: link.Text,
+			Rel:        link.Rel,
+			Element:    link.Element,
+			Kind:       string(link.Kind),
+			Internal:   r.scope.allowsHost(target),
+		})
+		if follow && r.followable(link) {
+			links = append(links, target)
+		}
+	}
+	if err := c.db.StoreLinks(u.String(), r.jobID, edges); err != nil {
+		log.Printf("Failed to store links of %s: %v", u.String(), err)
+	}
+
 	if resp.StatusCode != 200 {
 		log.Printf("Non-200 status code for %s: %d", u.String(), resp.StatusCode)
 		return nil
 	}
-
-	links, err := parser.ExtractLinks(resp.Body, u)
-	if err != nil {
-		log.Printf("Link extraction error for %s: %v", u.String(), err)
-		return err
+	if readErr != nil {
+		return readErr
+	}
+	log.Printf("Found %d links on %s", len(edges), u.String())
+	if !follow {
+		log.Printf("Not following links of %s (nofollow)", u.String())
+		return nil
 	}
+	return c.followLinks(r, it, links)
+}
+
+// followable reports whether a link of a page is followed: assets never
+// are, and nofollow links only when the crawl ignores nofollow.
+func (r *crawlRun) followable(link parser.Link) bool {
+	return link.Kind != parser.KindAsset && (!link.NoFollow() || r.opts.IgnoreNoFollow)
+}
 
-	log.Printf("Found %d links on %s", len(links), u.String())
+// followLinks queues the links of the page at it that are in scope and
+// allowed by robots.txt, and records the others in the frontier.
+func (c *Crawler) followLinks(r *crawlRun, it item, links []*url.URL) error {
+	u := it.url
+	if r.opts.MaxDepth > 0 && it.depth >= r.opts.MaxDepth {
+		log.Printf("Max depth reached at %s, not following links", u.String())
+		return nil
+	}
 
 	for _, link := range links {
-		if !robots.IsAllowed(link.Path) {
-			log.Printf("Skipping disallowed URL: %s", link.String())
+		if !r.scope.contains(link) {
+			// Keep track of out-of-scope links without fetching them
+			r.frontier.record(link, database.FrontierEntry{
+				Depth:  it.depth + 1,
+				State:  database.FrontierOutOfScope,
+				Source: database.SourceLink,
+				Parent: u.String(),
+			})
 			continue
 		}
-		if link.Host != u.Host {
-			log.Printf("Skipping external URL: %s", link.String())
+		if !c.robotsFor(r, link).IsAllowed(link.Path) {
+			log.Printf("Skipping disallowed URL: %s", link.String())
+			blocked := item{url: link, depth: it.depth + 1, source: database.SourceLink, parent: u.String()}
+			if r.frontier.record(link, database.FrontierEntry{
+				Depth:  blocked.depth,
+				State:  database.FrontierBlocked,
+				Source: blocked.source,
+				Parent: blocked.parent,
+			}) {
+				c.storeError(r, blocked, 0, nil, errRobotsBlocked)
+			}
 			continue
 		}
-		if err := c.crawl(link, robots); err != nil {
-			log.Printf("Error crawling %s: %v", link.String(), err)
-		}
+		r.frontier.push(link, database.FrontierEntry{
+			Depth:  it.depth + 1,
+			Source: database.SourceLink,
+			Parent: u.String(),
+		})
 	}
 
 	return nil
 }
 
-func (c *Crawler) storeError(u *url.URL, err error) error {
-	return c.db.StorePage(database.PageData{
-		URL:        u.String(),
-		StatusCode: 0,
-		CrawledAt:  time.Now(),
-	})
+// isHTML reports whether a Content-Type header denotes an HTML document.
+// Pages without one are parsed as HTML too.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// userAgentTransport sets the crawler's User-Agent on every outgoing
+// request, including robots.txt fetches and redirects.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// storeError records a page that could not be fetched or processed, along
+// with the category of the error and the redirects followed, if any.
+func (c *Crawler) storeError(r *crawlRun, it item, attempts int, trace *requestTrace, err error) {
+	page := database.PageData{
+		URL:           it.url.String(),
+		StatusCode:    0,
+		CrawledAt:     time.Now(),
+		JobID:         r.jobID,
+		Source:        it.source,
+		Attempts:      attempts,
+		ErrorCategory: classifyError(err),
+		ErrorMessage:  err.Error(),
+		Depth:         it.depth,
+		ParentURL:     it.parent,
+	}
+	if trace != nil {
+		page.ResponseTime = trace.responseTime
+	}
+	if trace != nil && len(trace.hops) > 0 {
+		page.FinalURL = trace.hops[len(trace.hops)-1].Target
+	}
+	if err := c.db.StorePage(page); err != nil {
+		log.Printf("Failed to store error page: %v", err)
+		return
+	}
+	if trace != nil {
+		c.storeRedirects(r, it.url, trace)
+	}
+}
+
+// storeRedirects records the redirects followed for u, replacing those of
+// a previous crawl.
+func (c *Crawler) storeRedirects(r *crawlRun, u *url.URL, trace *requestTrace) {
+	if err := c.db.StoreRedirects(u.String(), r.jobID, trace.hops); err != nil {
+		log.Printf("Failed to store redirects of %s: %v", u.String(), err)
+	}
 }
@@ -1,10 +1,20 @@
 package crawler
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"spiderlite/internal/database"
 	"spiderlite/internal/metrics"
@@ -44,7 +54,7 @@ func TestCrawler(t *testing.T) {
 
 	// Start crawl
 	startURL, _ := url.Parse(ts.URL)
-	if err := c.Start(startURL); err != nil {
+	if _, err := c.Start(context.Background(), startURL, Options{}); err != nil {
 		t.Errorf("Crawl failed: %v", err)
 	}
 
@@ -66,3 +76,1941 @@ func TestCrawler(t *testing.T) {
 		}
 	}
 }
+
+func TestCrawlerWorkers(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	// Every page links to the next ten pages and back to the root
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		var n int
+		if r.URL.Path != "/" {
+			if _, err := fmt.Sscanf(r.URL.Path, "/page%d", &n); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		fmt.Fprint(w, `<html><body><a href="/">Home</a>`)
+		for i := n + 1; i <= n+10 && i <= 50; i++ {
+			fmt.Fprintf(w, `<a href="/page%d">Page %d</a>`, i, i)
+		}
+		fmt.Fprint(w, `</body></html>`)
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithWorkers(4))
+
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pages").Scan(&count); err != nil {
+		t.Fatalf("Failed to count pages: %v", err)
+	}
+	// Root plus /page1 to /page50
+	if count != 51 {
+		t.Errorf("Expected 51 pages, got %d", count)
+	}
+
+	for path, n := range hits {
+		if path != "/robots.txt" && path != "/sitemap.xml" && n != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", path, n)
+		}
+	}
+}
+
+func TestCrawlerResume(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" || r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`<html><body>
+			<a href="/page1">Page 1</a>
+			<a href="/page2">Page 2</a>
+		</body></html>`))
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Simulate a crawl interrupted while /page1 was being fetched
+	seed := ts.URL
+	jobID, err := db.CreateJob(seed+"/", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	for _, entry := range []database.FrontierEntry{
+		{URL: seed + "/", State: database.FrontierDone},
+		{URL: seed + "/page1", Depth: 1, State: database.FrontierInFlight},
+		{URL: seed + "/page2", Depth: 1, State: database.FrontierDone},
+	} {
+		if err := db.EnqueueURL(jobID, entry); err != nil {
+			t.Fatalf("EnqueueURL() error = %v", err)
+		}
+		if err := db.SetFrontierState(jobID, entry.URL, entry.State); err != nil {
+			t.Fatalf("SetFrontierState() error = %v", err)
+		}
+	}
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(seed)
+	result, err := c.ResumeOrStart(context.Background(), startURL, Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if result.JobID != jobID {
+		t.Errorf("Expected job %d to be resumed, got job %d", jobID, result.JobID)
+	}
+
+	if len(fetched) != 1 || fetched[0] != "/page1" {
+		t.Errorf("Expected only /page1 to be fetched, got %v", fetched)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if job.State != database.JobCompleted {
+		t.Errorf("Expected job to be completed, got %s", job.State)
+	}
+
+	// A new crawl of the same URL starts over
+	fetched = nil
+	result, err = c.ResumeOrStart(context.Background(), startURL, Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if result.JobID == jobID {
+		t.Errorf("Expected a new job once job %d completed", jobID)
+	}
+	if len(fetched) != 3 {
+		t.Errorf("Expected 3 pages fetched on a new crawl, got %v", fetched)
+	}
+}
+
+func TestCrawlerLimits(t *testing.T) {
+	// An endless chain of pages: /page0 links to /page1 which links to /page2...
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/page%d", &n); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<html><body><a href="/page%d">Next</a><a href="/page%d">Skip</a></body></html>`, n+1, n+2)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		opts       Options
+		wantPages  int
+		wantReason StopReason
+	}{
+		{
+			name:       "max depth",
+			opts:       Options{MaxDepth: 2},
+			wantPages:  5, // page0, page1, page2, page3, page4
+			wantReason: StopCompleted,
+		},
+		{
+			name:       "max pages",
+			opts:       Options{MaxPages: 10},
+			wantPages:  10,
+			wantReason: StopMaxPages,
+		},
+		{
+			name:       "max duration",
+			opts:       Options{MaxDuration: 200 * time.Millisecond},
+			wantReason: StopMaxDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewDB(":memory:")
+			if err != nil {
+				t.Fatalf("Failed to create database: %v", err)
+			}
+			defer db.Close()
+
+			c := New(db, metrics.NewNoopMetrics(), WithWorkers(2))
+			startURL, _ := url.Parse(ts.URL + "/page0")
+			result, err := c.Start(context.Background(), startURL, tt.opts)
+			if err != nil {
+				t.Fatalf("Crawl failed: %v", err)
+			}
+
+			if result.StopReason != tt.wantReason {
+				t.Errorf("Want stop reason %s, got %s", tt.wantReason, result.StopReason)
+			}
+			if tt.wantPages > 0 && result.Pages != tt.wantPages {
+				t.Errorf("Want %d pages, got %d", tt.wantPages, result.Pages)
+			}
+
+			entries, err := db.GetFrontier(result.JobID)
+			if err != nil {
+				t.Fatalf("GetFrontier() error = %v", err)
+			}
+			for _, entry := range entries {
+				if entry.State == database.FrontierQueued || entry.State == database.FrontierInFlight {
+					t.Errorf("Expected %s to be skipped, got %s", entry.URL, entry.State)
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlerPoliteness(t *testing.T) {
+	var mu sync.Mutex
+	var robotsFetched time.Time
+	var times []time.Time
+	var active, maxActive int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			mu.Lock()
+			robotsFetched = time.Now()
+			mu.Unlock()
+			w.Write([]byte("User-agent: *\nCrawl-delay: 0.05\n"))
+			return
+		}
+		if r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		times = append(times, time.Now())
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+
+		time.Sleep(80 * time.Millisecond)
+		w.Write([]byte(`<html><body>
+			<a href="/page1">1</a><a href="/page2">2</a>
+			<a href="/page3">3</a><a href="/page4">4</a>
+		</body></html>`))
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithWorkers(4), WithMaxHostConns(2))
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	if len(times) != 5 {
+		t.Fatalf("Expected 5 requests, got %d", len(times))
+	}
+	if gap := times[0].Sub(robotsFetched); gap < 45*time.Millisecond {
+		t.Errorf("First page requested only %s after robots.txt despite Crawl-delay", gap)
+	}
+	for i := 1; i < len(times); i++ {
+		// Allow for timer granularity
+		if gap := times[i].Sub(times[i-1]); gap < 45*time.Millisecond {
+			t.Errorf("Requests %d and %d only %s apart despite Crawl-delay", i-1, i, gap)
+		}
+	}
+	if maxActive > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", maxActive)
+	}
+}
+
+func TestHostLimiterCrawlDelay(t *testing.T) {
+	l := newHostLimiter(10*time.Millisecond, 0)
+	release, err := l.acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	release()
+	requested := time.Now()
+
+	// A Crawl-delay learned after a request applies to the next one
+	l.setCrawlDelay("example.com", 50*time.Millisecond)
+	release, err = l.acquire(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	release()
+	if gap := time.Since(requested); gap < 45*time.Millisecond {
+		t.Errorf("Expected the next request to wait for the Crawl-delay, waited %s", gap)
+	}
+
+	l.setCrawlDelay("example.com", 24*time.Hour)
+	if h := l.host("example.com"); h.delay != maxCrawlDelay {
+		t.Errorf("Expected Crawl-delay capped to %s, got %s", maxCrawlDelay, h.delay)
+	}
+	l.setCrawlDelay("example.com", time.Millisecond)
+	if h := l.host("example.com"); h.delay != 10*time.Millisecond {
+		t.Errorf("Expected the minimum delay to apply, got %s", h.delay)
+	}
+}
+
+func TestCrawlerUnresponsiveRobots(t *testing.T) {
+	// robots.txt never answers
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+		case "/":
+			w.Write([]byte(`<html><body><a href="/page1">1</a><a href="/page2">2</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body></body></html>`))
+		}
+	}))
+	defer ts.Close()
+	defer close(hang)
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithWorkers(4), WithRetries(0), WithRequestTimeout(200*time.Millisecond))
+	startURL, _ := url.Parse(ts.URL + "/")
+
+	started := time.Now()
+	result, err := c.Start(context.Background(), startURL, Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected the robots.txt fetch to time out, crawl took %s", elapsed)
+	}
+	if result.Pages != 3 {
+		t.Errorf("Expected 3 pages crawled, got %d", result.Pages)
+	}
+}
+
+func TestCrawlerIdentity(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	agents := make(map[string]bool)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.UserAgent()] = true
+		mu.Unlock()
+
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /\n\nUser-agent: testbot\nDisallow: /private\n"))
+			return
+		}
+		if r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`<html><body>
+			<a href="/public">Public</a>
+			<a href="/private">Private</a>
+		</body></html>`))
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(),
+		WithUserAgent("TestBot/2.0 (+https://example.com/bot)"),
+		WithRobotsToken("testbot"),
+	)
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	// The testbot group allows everything but /private
+	if len(fetched) != 2 {
+		t.Errorf("Expected / and /public to be fetched, got %v", fetched)
+	}
+	for _, path := range fetched {
+		if path == "/private" {
+			t.Errorf("Fetched /private despite robots.txt")
+		}
+	}
+
+	if len(agents) != 1 || !agents["TestBot/2.0 (+https://example.com/bot)"] {
+		t.Errorf("Expected every request to use the configured User-Agent, got %v", agents)
+	}
+}
+
+// waitForJob polls the database until the job reaches the given state.
+func waitForJob(t *testing.T, db *database.DB, jobID int64, state string) *database.CrawlJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := db.GetJob(jobID)
+		if err != nil {
+			t.Fatalf("GetJob() error = %v", err)
+		}
+		if job.State == state {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %d did not reach state %s", jobID, state)
+	return nil
+}
+
+func TestCrawlerPauseResumeCancel(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	// A chain of 20 slow pages
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/page%d", &n); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		if n < 19 {
+			fmt.Fprintf(w, `<html><body><a href="/page%d">Next</a></body></html>`, n+1)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithWorkers(1))
+	startURL, _ := url.Parse(ts.URL + "/page0")
+
+	t.Run("pause and resume", func(t *testing.T) {
+		jobID, err := c.Submit(startURL, Options{})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+
+		waitForJob(t, db, jobID, database.JobRunning)
+		time.Sleep(100 * time.Millisecond)
+		if err := c.Pause(jobID); err != nil {
+			t.Fatalf("Pause() error = %v", err)
+		}
+		job := waitForJob(t, db, jobID, database.JobPaused)
+		if job.PagesCrawled == 0 || job.PagesCrawled >= 20 {
+			t.Errorf("Expected the crawl to be paused midway, got %d pages", job.PagesCrawled)
+		}
+
+		if err := c.Resume(jobID); err != nil {
+			t.Fatalf("Resume() error = %v", err)
+		}
+		job = waitForJob(t, db, jobID, database.JobCompleted)
+		if job.PagesCrawled != 20 {
+			t.Errorf("Expected 20 pages crawled, got %d", job.PagesCrawled)
+		}
+
+		// Only the page interrupted by the pause may be fetched twice
+		mu.Lock()
+		defer mu.Unlock()
+		var refetched int
+		for path, n := range hits {
+			if n > 2 {
+				t.Errorf("Expected %s to be fetched at most twice, got %d", path, n)
+			}
+			if n == 2 {
+				refetched++
+			}
+		}
+		if refetched > 1 {
+			t.Errorf("Expected at most one page to be fetched again, got %d", refetched)
+		}
+	})
+
+	t.Run("limits across resume", func(t *testing.T) {
+		// Pages crawled before the pause count towards max_pages
+		jobID, err := c.Submit(startURL, Options{MaxPages: 5})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		waitForJob(t, db, jobID, database.JobRunning)
+		time.Sleep(60 * time.Millisecond)
+		if err := c.Pause(jobID); err != nil {
+			t.Fatalf("Pause() error = %v", err)
+		}
+		waitForJob(t, db, jobID, database.JobPaused)
+		if err := c.Resume(jobID); err != nil {
+			t.Fatalf("Resume() error = %v", err)
+		}
+		job := waitForJob(t, db, jobID, database.JobCompleted)
+		if job.PagesCrawled != 5 || job.StopReason != string(StopMaxPages) {
+			t.Errorf("Expected 5 pages and stop reason %s, got %d pages and %s", StopMaxPages, job.PagesCrawled, job.StopReason)
+		}
+
+		// Time spent before and during the pause counts towards
+		// max_duration
+		jobID, err = c.Submit(startURL, Options{MaxDuration: 200 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		waitForJob(t, db, jobID, database.JobRunning)
+		time.Sleep(60 * time.Millisecond)
+		if err := c.Pause(jobID); err != nil {
+			t.Fatalf("Pause() error = %v", err)
+		}
+		paused := waitForJob(t, db, jobID, database.JobPaused)
+		time.Sleep(200 * time.Millisecond)
+		if err := c.Resume(jobID); err != nil {
+			t.Fatalf("Resume() error = %v", err)
+		}
+		job = waitForJob(t, db, jobID, database.JobCompleted)
+		if job.StopReason != string(StopMaxDuration) {
+			t.Errorf("Expected stop reason %s, got %s", StopMaxDuration, job.StopReason)
+		}
+		if job.PagesCrawled != paused.PagesCrawled {
+			t.Errorf("Expected no page crawled after resuming past max_duration, got %d more", job.PagesCrawled-paused.PagesCrawled)
+		}
+	})
+
+	t.Run("resume right after pause", func(t *testing.T) {
+		jobID, err := c.Submit(startURL, Options{})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			waitForJob(t, db, jobID, database.JobRunning)
+			if err := c.Pause(jobID); err != nil {
+				t.Fatalf("Pause() error = %v", err)
+			}
+			// Resume as soon as the job is saved as paused, without
+			// waiting for its goroutine to exit
+			for {
+				job, err := db.GetJob(jobID)
+				if err != nil {
+					t.Fatalf("GetJob() error = %v", err)
+				}
+				if job.State == database.JobPaused {
+					break
+				}
+			}
+			if err := c.Resume(jobID); err != nil {
+				t.Fatalf("Resume() error = %v", err)
+			}
+		}
+		job := waitForJob(t, db, jobID, database.JobCompleted)
+		if job.PagesCrawled != 20 {
+			t.Errorf("Expected 20 pages crawled, got %d", job.PagesCrawled)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		jobID, err := c.Submit(startURL, Options{})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+
+		waitForJob(t, db, jobID, database.JobRunning)
+		if err := c.Cancel(jobID); err != nil {
+			t.Fatalf("Cancel() error = %v", err)
+		}
+		job := waitForJob(t, db, jobID, database.JobCancelled)
+		if job.StopReason != string(StopCancelled) {
+			t.Errorf("Expected stop reason %s, got %s", StopCancelled, job.StopReason)
+		}
+
+		if err := c.Cancel(jobID); err != ErrJobNotActive {
+			t.Errorf("Expected ErrJobNotActive when cancelling twice, got %v", err)
+		}
+		if err := c.Resume(jobID); err != ErrJobNotPaused {
+			t.Errorf("Expected ErrJobNotPaused when resuming a cancelled job, got %v", err)
+		}
+	})
+}
+
+func TestCrawlerSitemaps(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %s/sitemap-index.xml\n", ts.URL)
+		case "/sitemap-index.xml":
+			fmt.Fprintf(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<sitemap><loc>%s/sitemap-pages.xml.gz</loc></sitemap>
+			</sitemapindex>`, ts.URL)
+		case "/sitemap-pages.xml.gz":
+			gz := gzip.NewWriter(w)
+			fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>%s/</loc></url>
+				<url><loc>%s/orphan</loc><lastmod>2024-01-02</lastmod><priority>0.8</priority></url>
+				<url><loc>https://other.example/page</loc></url>
+			</urlset>`, ts.URL, ts.URL)
+			gz.Close()
+		case "/":
+			w.Write([]byte(`<html><body><a href="/linked">Linked</a></body></html>`))
+		case "/linked", "/orphan":
+			w.Write([]byte(`<html><body>Test page</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("Failed to get pages: %v", err)
+	}
+	sources := make(map[string]string)
+	for _, page := range pages {
+		sources[page.URL] = page.Source
+	}
+	want := map[string]string{
+		ts.URL + "/":       database.SourceSeed,
+		ts.URL + "/linked": database.SourceLink,
+		ts.URL + "/orphan": database.SourceSitemap,
+	}
+	if len(sources) != len(want) {
+		t.Errorf("Expected pages %v, got %v", want, sources)
+	}
+	for u, source := range want {
+		if sources[u] != source {
+			t.Errorf("Expected %s to come from %q, got %q", u, source, sources[u])
+		}
+	}
+
+	entries, err := db.GetFrontier(result.JobID)
+	if err != nil {
+		t.Fatalf("GetFrontier() error = %v", err)
+	}
+	for _, entry := range entries {
+		if entry.URL != ts.URL+"/orphan" {
+			continue
+		}
+		if entry.LastMod != "2024-01-02" || entry.Priority == nil || *entry.Priority != 0.8 {
+			t.Errorf("Expected sitemap lastmod and priority to be recorded, got %q %v", entry.LastMod, entry.Priority)
+		}
+	}
+
+	mu.Lock()
+	if hits["/sitemap.xml"] != 0 {
+		t.Errorf("Expected /sitemap.xml not to be fetched when robots.txt declares sitemaps")
+	}
+	hits = make(map[string]int)
+	mu.Unlock()
+
+	// Sitemaps are not read when disabled
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/sitemap-index.xml"] != 0 || hits["/orphan"] != 0 {
+		t.Errorf("Expected sitemaps to be skipped, got %v", hits)
+	}
+}
+
+func TestCrawlerNormalization(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.RequestURI()]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body>
+				<a href="/page">Page</a>
+				<a href="/page#top">Top</a>
+				<a href="/a/../page">Dot segments</a>
+				<a href="/page?utm_source=news">Tracked</a>
+				<a href="/list?b=2&a=1">List</a>
+				<a href="/list?a=1&b=2&utm_medium=email">Sorted list</a>
+			</body></html>`))
+		case "/page", "/list":
+			w.Write([]byte(`<html><body>Test page</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "#main")
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("Failed to get pages: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, page := range pages {
+		got[page.URL] = true
+	}
+	for _, want := range []string{ts.URL + "/", ts.URL + "/page", ts.URL + "/list?a=1&b=2"} {
+		if !got[want] {
+			t.Errorf("Expected %s to be stored, got %v", want, got)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("Expected 3 pages, got %v", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for uri, n := range hits {
+		if n != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", uri, n)
+		}
+	}
+}
+
+func TestCrawlerScope(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.Host+r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" || r.URL.Path == "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`<html><body>Test page</body></html>`))
+	}
+	other := httptest.NewServer(http.HandlerFunc(handler))
+	defer other.Close()
+	external := httptest.NewServer(http.HandlerFunc(handler))
+	defer external.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			handler(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<html><body>
+			<a href="/docs/intro">Intro</a>
+			<a href="/docs/private/notes">Private</a>
+			<a href="/docs/guide.pdf">PDF</a>
+			<a href="/blog/post">Blog</a>
+			<a href="%s/docs/other">Other host</a>
+			<a href="%s/docs/external">External</a>
+			<a href="mailto:someone@example.com">Mail</a>
+		</body></html>`, other.URL, external.URL)
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	host := func(s string) string {
+		u, _ := url.Parse(s)
+		return u.Host
+	}
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{
+		AllowedHosts: []string{host(ts.URL), host(other.URL)},
+		PathPrefixes: []string{"/docs/"},
+		Exclude:      []string{"/docs/private/**", `re:\.pdf$`},
+	})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	entries, err := db.GetFrontier(result.JobID)
+	if err != nil {
+		t.Fatalf("GetFrontier() error = %v", err)
+	}
+	states := make(map[string]string)
+	for _, entry := range entries {
+		states[entry.URL] = entry.State
+	}
+	want := map[string]string{
+		ts.URL + "/":                    database.FrontierDone,
+		ts.URL + "/docs/intro":          database.FrontierDone,
+		other.URL + "/docs/other":       database.FrontierDone,
+		ts.URL + "/docs/private/notes":  database.FrontierOutOfScope,
+		ts.URL + "/docs/guide.pdf":      database.FrontierOutOfScope,
+		ts.URL + "/blog/post":           database.FrontierOutOfScope,
+		external.URL + "/docs/external": database.FrontierOutOfScope,
+	}
+	if len(states) != len(want) {
+		t.Errorf("Expected frontier %v, got %v", want, states)
+	}
+	for u, state := range want {
+		if states[u] != state {
+			t.Errorf("Expected %s to be %s, got %s", u, state, states[u])
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range hits {
+		if strings.HasPrefix(path, host(external.URL)) {
+			t.Errorf("Fetched out-of-scope host: %s", path)
+		}
+	}
+	if hits[host(other.URL)+"/robots.txt"] != 1 {
+		t.Errorf("Expected robots.txt of the other allowed host to be fetched once")
+	}
+}
+
+func TestScope(t *testing.T) {
+	startURL, _ := url.Parse("https://example.com/")
+
+	tests := []struct {
+		name string
+		opts Options
+		url  string
+		want bool
+	}{
+		{name: "seed host", url: "https://example.com/page", want: true},
+		{name: "other host", url: "https://other.com/page", want: false},
+		{name: "subdomain not included", url: "https://www.example.com/page", want: false},
+		{
+			name: "subdomain included",
+			opts: Options{IncludeSubdomains: true},
+			url:  "https://docs.example.com/page",
+			want: true,
+		},
+		{
+			name: "suffix is not a subdomain",
+			opts: Options{IncludeSubdomains: true},
+			url:  "https://notexample.com/page",
+			want: false,
+		},
+		{
+			name: "allowed host with any port",
+			opts: Options{AllowedHosts: []string{"Other.com"}},
+			url:  "https://other.com:8443/page",
+			want: true,
+		},
+		{
+			name: "path prefix",
+			opts: Options{PathPrefixes: []string{"/docs/"}},
+			url:  "https://example.com/blog/",
+			want: false,
+		},
+		{
+			name: "glob stays within a segment",
+			opts: Options{Include: []string{"/docs/*"}},
+			url:  "https://example.com/docs/a/b",
+			want: false,
+		},
+		{
+			name: "double star glob",
+			opts: Options{Include: []string{"/docs/**"}},
+			url:  "https://example.com/docs/a/b",
+			want: true,
+		},
+		{
+			name: "regex against query",
+			opts: Options{Exclude: []string{`re:[?&]page=\d+`}},
+			url:  "https://example.com/list?page=2",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newScope(startURL, tt.opts)
+			if err != nil {
+				t.Fatalf("newScope() error = %v", err)
+			}
+			u, _ := url.Parse(tt.url)
+			if got := s.contains(u); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	if err := (Options{Include: []string{"re:("}}).Validate(); err == nil {
+		t.Errorf("Expected an invalid regular expression to be rejected")
+	}
+}
+
+// retryMetrics counts the retries reported by the crawler.
+type retryMetrics struct {
+	metrics.NoopMetrics
+	mu      sync.Mutex
+	retries int
+}
+
+func (m *retryMetrics) IncrementRetries(host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries++
+}
+
+func TestCrawlerRetries(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body>
+				<a href="/flaky">Flaky</a>
+				<a href="/limited">Limited</a>
+				<a href="/broken">Broken</a>
+				<a href="/missing">Missing</a>
+			</body></html>`))
+		case "/flaky":
+			if n <= 2 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`<html><body>Test page</body></html>`))
+		case "/limited":
+			if n == 1 {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`<html><body>Test page</body></html>`))
+		case "/broken":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	m := &retryMetrics{}
+	c := New(db, m, WithRetries(2), WithRetryBackoff(time.Millisecond))
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("Failed to get pages: %v", err)
+	}
+	got := make(map[string]database.PageData)
+	for _, page := range pages {
+		got[page.URL] = page
+	}
+
+	tests := []struct {
+		path     string
+		status   int
+		attempts int
+	}{
+		{"/", http.StatusOK, 1},
+		{"/flaky", http.StatusOK, 3},
+		{"/limited", http.StatusOK, 2},
+		{"/broken", http.StatusInternalServerError, 3},
+		{"/missing", http.StatusNotFound, 1},
+	}
+	for _, tt := range tests {
+		page := got[ts.URL+tt.path]
+		if page.StatusCode != tt.status || page.Attempts != tt.attempts {
+			t.Errorf("Expected %s to have status %d after %d attempts, got %d after %d",
+				tt.path, tt.status, tt.attempts, page.StatusCode, page.Attempts)
+		}
+	}
+	if m.retries != 5 {
+		t.Errorf("Expected 5 retries, got %d", m.retries)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	c := New(nil, metrics.NewNoopMetrics(), WithRetryBackoff(100*time.Millisecond))
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		backoff := 100 * time.Millisecond << (attempt - 1)
+		if d := c.retryDelay(attempt, nil); d < backoff/2 || d > backoff {
+			t.Errorf("Attempt %d: expected a delay between %s and %s, got %s", attempt, backoff/2, backoff, d)
+		}
+	}
+	if d := c.retryDelay(40, nil); d > maxRetryDelay {
+		t.Errorf("Expected the delay to be capped at %s, got %s", maxRetryDelay, d)
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", "5")
+	if d := c.retryDelay(1, resp); d != 5*time.Second {
+		t.Errorf("Expected Retry-After in seconds to be honored, got %s", d)
+	}
+	resp.Header.Set("Retry-After", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+	if d := c.retryDelay(1, resp); d < 8*time.Second || d > 10*time.Second {
+		t.Errorf("Expected Retry-After date to be honored, got %s", d)
+	}
+	resp.Header.Set("Retry-After", "3600")
+	if d := c.retryDelay(1, resp); d != maxRetryDelay {
+		t.Errorf("Expected Retry-After to be capped at %s, got %s", maxRetryDelay, d)
+	}
+}
+
+func TestCrawlerErrors(t *testing.T) {
+	page := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write([]byte(`<html><body>Test page</body></html>`))
+	}
+	secure := httptest.NewTLSServer(http.HandlerFunc(page))
+	defer secure.Close()
+	closed := httptest.NewServer(http.HandlerFunc(page))
+	closed.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<a href="/slow">Slow</a>
+				<a href="/large">Large</a>
+				<a href="/private">Private</a>
+				<a href="%s/page">TLS</a>
+				<a href="%s/page">Closed</a>
+			</body></html>`, secure.URL, closed.URL)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			page(w, r)
+		case "/large":
+			w.Write([]byte(strings.Repeat("x", 2048)))
+		default:
+			page(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	hosts := []string{}
+	for _, s := range []string{ts.URL, secure.URL, closed.URL} {
+		u, _ := url.Parse(s)
+		hosts = append(hosts, u.Host)
+	}
+
+	c := New(db, metrics.NewNoopMetrics(),
+		WithRetries(0),
+		WithRequestTimeout(100*time.Millisecond),
+		WithMaxBodySize(1024),
+	)
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{AllowedHosts: hosts, SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	want := map[string]string{
+		ts.URL + "/":         "",
+		ts.URL + "/slow":     database.ErrorTimeout,
+		ts.URL + "/large":    database.ErrorBodyTooLarge,
+		ts.URL + "/private":  database.ErrorRobotsBlocked,
+		secure.URL + "/page": database.ErrorTLS,
+		closed.URL + "/page": database.ErrorConnectionRefused,
+	}
+	for u, category := range want {
+		pages, err := db.GetPagesByError(category)
+		if err != nil {
+			t.Fatalf("GetPagesByError() error = %v", err)
+		}
+		var found *database.PageData
+		for i := range pages {
+			if pages[i].URL == u {
+				found = &pages[i]
+			}
+		}
+		if category == "" {
+			if found != nil {
+				t.Errorf("Expected %s not to have an error, got %s", u, found.ErrorCategory)
+			}
+			continue
+		}
+		if found == nil {
+			t.Errorf("Expected %s to fail with %s, got %v", u, category, pages)
+		} else if found.ErrorMessage == "" {
+			t.Errorf("Expected an error message for %s", u)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&url.Error{Op: "Get", URL: "http://nowhere.invalid", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid"}}, database.ErrorDNS},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, database.ErrorConnectionReset},
+		{fmt.Errorf("reading body: %w", context.DeadlineExceeded), database.ErrorTimeout},
+		{errors.New("unsupported protocol scheme"), database.ErrorNetwork},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCrawlerRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body>
+				<a href="/old">Old</a>
+				<a href="/loop-a">Loop</a>
+				<a href="/hop1">Long chain</a>
+			</body></html>`))
+		case "/old":
+			http.Redirect(w, r, "/moved/", http.StatusMovedPermanently)
+		case "/moved/":
+			http.Redirect(w, r, "/moved/new", http.StatusFound)
+		case "/moved/new":
+			// Relative links resolve against the final URL
+			w.Write([]byte(`<html><body><a href="child">Child</a></body></html>`))
+		case "/moved/child":
+			w.Write([]byte(`<html><body>Test page</body></html>`))
+		case "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		default:
+			var n int
+			if _, err := fmt.Sscanf(r.URL.Path, "/hop%d", &n); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("/hop%d", n+1), http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithMaxRedirects(3))
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("Failed to get pages: %v", err)
+	}
+	got := make(map[string]database.PageData)
+	for _, page := range pages {
+		got[page.URL] = page
+	}
+	if page := got[ts.URL+"/old"]; page.StatusCode != 200 || page.FinalURL != ts.URL+"/moved/new" {
+		t.Errorf("Expected /old to end at /moved/new with status 200, got %d at %s", page.StatusCode, page.FinalURL)
+	}
+	if _, ok := got[ts.URL+"/moved/child"]; !ok {
+		t.Errorf("Expected links of a redirected page to resolve against its final URL")
+	}
+	if page := got[ts.URL+"/loop-a"]; page.ErrorCategory != database.ErrorRedirectLoop {
+		t.Errorf("Expected /loop-a to be a redirect loop, got %q", page.ErrorCategory)
+	}
+	if page := got[ts.URL+"/hop1"]; page.ErrorCategory != database.ErrorTooManyRedirects || page.Attempts != 1 {
+		t.Errorf("Expected /hop1 to fail once with too many redirects, got %q after %d attempts", page.ErrorCategory, page.Attempts)
+	}
+
+	chains, err := db.GetRedirectChains(1, false)
+	if err != nil {
+		t.Fatalf("GetRedirectChains() error = %v", err)
+	}
+	hops := make(map[string][]database.RedirectHop)
+	loops := make(map[string]bool)
+	for _, chain := range chains {
+		hops[chain.URL] = chain.Hops
+		loops[chain.URL] = chain.Loop
+	}
+	want := []database.RedirectHop{
+		{Source: ts.URL + "/old", Target: ts.URL + "/moved/", StatusCode: http.StatusMovedPermanently},
+		{Source: ts.URL + "/moved/", Target: ts.URL + "/moved/new", StatusCode: http.StatusFound},
+	}
+	if fmt.Sprint(hops[ts.URL+"/old"]) != fmt.Sprint(want) {
+		t.Errorf("Expected hops %v for /old, got %v", want, hops[ts.URL+"/old"])
+	}
+	if len(hops[ts.URL+"/hop1"]) != 4 {
+		t.Errorf("Expected 4 hops for /hop1, got %v", hops[ts.URL+"/hop1"])
+	}
+	if !loops[ts.URL+"/loop-a"] || loops[ts.URL+"/old"] {
+		t.Errorf("Expected only /loop-a to be a loop, got %v", loops)
+	}
+
+	chains, err = db.GetRedirectChains(3, true)
+	if err != nil {
+		t.Fatalf("GetRedirectChains() error = %v", err)
+	}
+	if len(chains) != 1 || chains[0].URL != ts.URL+"/loop-a" {
+		t.Errorf("Expected only the loop, got %v", chains)
+	}
+}
+
+func TestCrawlerMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("X-Served-By", "test")
+			w.Write([]byte(`<html><head>
+				<title>Home</title>
+				<meta name="description" content="The home page">
+				<link rel="canonical" href="/index">
+			</head><body><a href="/doc.pdf">Doc</a><a href="/about">About</a></body></html>`))
+		case "/about":
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`<html><head><title>About</title></head><body></body></html>`))
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte(`<a href="/hidden">Not HTML</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("Failed to get pages: %v", err)
+	}
+	got := make(map[string]database.PageData)
+	for _, page := range pages {
+		got[page.URL] = page
+	}
+	// The canonical link is followed too
+	if len(got) != 4 {
+		t.Errorf("Expected 4 pages, got %d", len(got))
+	}
+
+	home := got[ts.URL+"/"]
+	if home.Title != "Home" || home.Description != "The home page" || home.CanonicalURL != ts.URL+"/index" {
+		t.Errorf("Unexpected metadata for the home page: %q %q %q", home.Title, home.Description, home.CanonicalURL)
+	}
+	if home.ContentType != "text/html; charset=utf-8" || home.ContentLength == 0 {
+		t.Errorf("Unexpected content type %q and length %d", home.ContentType, home.ContentLength)
+	}
+	if home.Headers["X-Served-By"][0] != "test" {
+		t.Errorf("Expected response headers to be stored, got %v", home.Headers)
+	}
+	if home.Depth != 0 || home.ParentURL != "" {
+		t.Errorf("Expected the seed at depth 0 without parent, got %d and %q", home.Depth, home.ParentURL)
+	}
+
+	about := got[ts.URL+"/about"]
+	if about.Title != "About" || about.Depth != 1 || about.ParentURL != ts.URL+"/" {
+		t.Errorf("Unexpected metadata for /about: %q, depth %d, parent %q", about.Title, about.Depth, about.ParentURL)
+	}
+	if about.ResponseTime < 20*time.Millisecond {
+		t.Errorf("Expected a response time of at least 20ms, got %s", about.ResponseTime)
+	}
+
+	if doc := got[ts.URL+"/doc.pdf"]; doc.ContentType != "application/pdf" || doc.Title != "" {
+		t.Errorf("Expected the PDF not to be parsed, got %+v", doc)
+	}
+}
+
+func TestCrawlerLinkGraph(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body>
+				<a href="/about">About us</a>
+				<a href="/missing" rel="nofollow">Old page</a>
+				<a href="https://external.example/">Partner</a>
+				<a href="mailto:someone@example.com">Mail</a>
+			</body></html>`))
+		case "/about":
+			w.Write([]byte(`<html><body><a href="/missing#top">Gone</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	outlinks, err := db.GetOutlinks(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GetOutlinks() error = %v", err)
+	}
+	want := []database.Link{
+		{SourceURL: ts.URL + "/", TargetURL: ts.URL + "/about", AnchorText: "About us", Element: "a", Kind: "navigation", Internal: true, JobID: result.JobID},
+		{SourceURL: ts.URL + "/", TargetURL: ts.URL + "/missing", AnchorText: "Old page", Rel: "nofollow", Element: "a", Kind: "navigation", Internal: true, JobID: result.JobID},
+		{SourceURL: ts.URL + "/", TargetURL: "https://external.example/", AnchorText: "Partner", Element: "a", Kind: "navigation", JobID: result.JobID},
+	}
+	if fmt.Sprint(outlinks) != fmt.Sprint(want) {
+		t.Errorf("Expected outlinks %v, got %v", want, outlinks)
+	}
+
+	inlinks, err := db.GetInlinks(ts.URL + "/missing")
+	if err != nil {
+		t.Fatalf("GetInlinks() error = %v", err)
+	}
+	sources := make(map[string]string)
+	for _, link := range inlinks {
+		sources[link.SourceURL] = link.AnchorText
+	}
+	if len(inlinks) != 2 || sources[ts.URL+"/"] != "Old page" || sources[ts.URL+"/about"] != "Gone" {
+		t.Errorf("Expected /missing to be linked from / and /about, got %v", inlinks)
+	}
+
+	// The outlinks of a page are replaced when it is crawled again
+	if _, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	outlinks, err = db.GetOutlinks(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GetOutlinks() error = %v", err)
+	}
+	if len(outlinks) != 3 {
+		t.Errorf("Expected 3 outlinks after a new crawl, got %d", len(outlinks))
+	}
+}
+
+func TestCrawlerBrokenLinks(t *testing.T) {
+	var mu sync.Mutex
+	heads := 0
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			mu.Lock()
+			heads++
+			mu.Unlock()
+		}
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			// Some servers reject HEAD requests
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<a href="/missing">Old page</a>
+				<a href="/error">Flaky page</a>
+				<a href="%[1]s/ok">Partner</a>
+				<a href="%[1]s/no-head">Legacy partner</a>
+				<a href="%[1]s/gone">Former partner</a>
+			</body></html>`, external.URL)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics(), WithRetries(0))
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	broken, err := db.GetBrokenLinks(result.JobID)
+	if err != nil {
+		t.Fatalf("GetBrokenLinks() error = %v", err)
+	}
+	if len(broken) != 2 {
+		t.Fatalf("Expected 2 broken links before checking external links, got %v", broken)
+	}
+	if broken[0].URL != ts.URL+"/error" || broken[0].StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected %s/error with status 500, got %+v", ts.URL, broken[0])
+	}
+	if broken[1].URL != ts.URL+"/missing" || broken[1].StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %s/missing with status 404, got %+v", ts.URL, broken[1])
+	}
+	sources := broken[1].Sources
+	if len(sources) != 1 || sources[0].SourceURL != ts.URL+"/" || sources[0].AnchorText != "Old page" {
+		t.Errorf("Expected /missing to be linked from / as \"Old page\", got %v", sources)
+	}
+
+	checked, err := c.CheckExternalLinks(context.Background(), result.JobID)
+	if err != nil {
+		t.Fatalf("CheckExternalLinks() error = %v", err)
+	}
+	if checked != 3 {
+		t.Errorf("Expected 3 external links checked, got %d", checked)
+	}
+	mu.Lock()
+	if heads != 3 {
+		t.Errorf("Expected external links to be checked with 3 HEAD requests, got %d", heads)
+	}
+	mu.Unlock()
+
+	broken, err = db.GetBrokenLinks(0)
+	if err != nil {
+		t.Fatalf("GetBrokenLinks() error = %v", err)
+	}
+	if len(broken) != 3 {
+		t.Fatalf("Expected 3 broken links after checking external links, got %v", broken)
+	}
+	var gone database.BrokenLink
+	for _, b := range broken {
+		if b.URL == external.URL+"/gone" {
+			gone = b
+		}
+	}
+	if !gone.Checked || gone.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %s/gone to be reported as a checked 404, got %+v", external.URL, gone)
+	}
+	if len(gone.Sources) != 1 || gone.Sources[0].AnchorText != "Former partner" || gone.Sources[0].Internal {
+		t.Errorf("Expected %s/gone to be linked from / as \"Former partner\", got %v", external.URL, gone.Sources)
+	}
+}
+
+func TestCrawlerCheckExternalOption(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer external.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><a href="%s/gone">Partner</a></body></html>`, external.URL)
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true, CheckExternal: true})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	broken, err := db.GetBrokenLinks(result.JobID)
+	if err != nil {
+		t.Fatalf("GetBrokenLinks() error = %v", err)
+	}
+	if len(broken) != 1 || broken[0].URL != external.URL+"/gone" {
+		t.Errorf("Expected the external link to be checked by the crawl, got %v", broken)
+	}
+}
+
+func TestCrawlerNoFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body>
+				<a href="/followed">Followed</a>
+				<a href="/sponsored" rel="sponsored nofollow">Sponsored</a>
+				<a href="/meta">Meta</a>
+				<a href="/header">Header</a>
+			</body></html>`))
+		case "/meta":
+			w.Write([]byte(`<html><head><meta name="robots" content="noindex, nofollow"></head>
+				<body><a href="/from-meta">Hidden</a></body></html>`))
+		case "/header":
+			w.Header().Set("X-Robots-Tag", "spiderlite: nofollow")
+			w.Write([]byte(`<html><body><a href="/from-header">Hidden</a></body></html>`))
+		case "/sitemap.xml":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(`<html><body>Leaf</body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	crawl := func(opts Options) map[string]database.PageData {
+		db, err := database.NewDB(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		defer db.Close()
+
+		c := New(db, metrics.NewNoopMetrics())
+		startURL, _ := url.Parse(ts.URL + "/")
+		if _, err := c.Start(context.Background(), startURL, opts); err != nil {
+			t.Fatalf("Crawl failed: %v", err)
+		}
+		pages, err := db.GetPages()
+		if err != nil {
+			t.Fatalf("GetPages() error = %v", err)
+		}
+		crawled := make(map[string]database.PageData)
+		for _, page := range pages {
+			crawled[strings.TrimPrefix(page.URL, ts.URL)] = page
+		}
+		return crawled
+	}
+
+	t.Run("honored", func(t *testing.T) {
+		pages := crawl(Options{})
+		for _, path := range []string{"/", "/followed", "/meta", "/header"} {
+			if _, ok := pages[path]; !ok {
+				t.Errorf("Expected %s to be crawled", path)
+			}
+		}
+		for _, path := range []string{"/sponsored", "/from-meta", "/from-header"} {
+			if _, ok := pages[path]; ok {
+				t.Errorf("Expected nofollow link %s not to be crawled", path)
+			}
+		}
+
+		if meta := pages["/meta"]; !meta.NoIndex || !meta.NoFollow {
+			t.Errorf("Expected /meta to be recorded as noindex and nofollow, got %+v", meta)
+		}
+		if header := pages["/header"]; header.NoIndex || !header.NoFollow {
+			t.Errorf("Expected /header to be recorded as nofollow only, got %+v", header)
+		}
+		if root := pages["/"]; root.NoIndex || root.NoFollow {
+			t.Errorf("Expected / to have no directives, got %+v", root)
+		}
+	})
+
+	t.Run("ignored", func(t *testing.T) {
+		pages := crawl(Options{IgnoreNoFollow: true})
+		for _, path := range []string{"/sponsored", "/from-meta", "/from-header"} {
+			if _, ok := pages[path]; !ok {
+				t.Errorf("Expected %s to be crawled when ignoring nofollow", path)
+			}
+		}
+		if meta := pages["/meta"]; !meta.NoIndex || !meta.NoFollow {
+			t.Errorf("Expected /meta directives to be recorded anyway, got %+v", meta)
+		}
+	})
+}
+
+func TestCrawlerTypedLinks(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] = r.Method
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Add("Link", `</docs/>; rel="canonical"`)
+			w.Write([]byte(`<html><head>
+				<base href="/docs/">
+				<link rel="stylesheet" href="site.css">
+				<meta http-equiv="refresh" content="10; url=moved">
+			</head><body>
+				<a href="guide">Guide</a>
+				<img src="logo.png" alt="Logo">
+				<img src="missing.png" alt="Missing">
+			</body></html>`))
+		case "/docs/", "/docs/guide", "/docs/moved":
+			w.Write([]byte(`<html><body>Docs</body></html>`))
+		case "/docs/site.css", "/docs/logo.png":
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	result, err := c.Start(context.Background(), startURL, Options{SkipSitemaps: true, CheckAssets: true})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	// Documents are crawled, assets only checked with HEAD requests
+	mu.Lock()
+	for _, path := range []string{"/docs/", "/docs/guide", "/docs/moved"} {
+		if requests[path] != http.MethodGet {
+			t.Errorf("Expected %s to be crawled, got %q", path, requests[path])
+		}
+	}
+	for _, path := range []string{"/docs/site.css", "/docs/logo.png", "/docs/missing.png"} {
+		if requests[path] != http.MethodHead {
+			t.Errorf("Expected asset %s to be checked, got %q", path, requests[path])
+		}
+	}
+	mu.Unlock()
+
+	outlinks, err := db.GetOutlinks(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GetOutlinks() error = %v", err)
+	}
+	kinds := make(map[string]string)
+	for _, link := range outlinks {
+		kinds[strings.TrimPrefix(link.TargetURL, ts.URL)] = link.Element + " " + link.Kind
+	}
+	want := map[string]string{
+		"/docs/":            "link-header canonical",
+		"/docs/site.css":    "link asset",
+		"/docs/moved":       "meta redirect",
+		"/docs/guide":       "a navigation",
+		"/docs/logo.png":    "img asset",
+		"/docs/missing.png": "img asset",
+	}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("Expected outlinks %v, got %v", want, kinds)
+	}
+
+	broken, err := db.GetBrokenLinks(result.JobID)
+	if err != nil {
+		t.Fatalf("GetBrokenLinks() error = %v", err)
+	}
+	if len(broken) != 1 || broken[0].URL != ts.URL+"/docs/missing.png" || !broken[0].Checked {
+		t.Errorf("Expected the missing image to be reported, got %v", broken)
+	}
+}
+
+func TestCrawlerConditionalRecrawl(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var mu sync.Mutex
+	version := "v1"
+	conditional := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			conditional[r.URL.Path]++
+		}
+		switch r.URL.Path {
+		case "/":
+			etag := `"` + version + `"`
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			body := `<html><head><title>Home</title></head><body><a href="/dated">Dated</a><a href="/plain">Plain</a>`
+			if version != "v1" {
+				body += `<a href="/new">New</a>`
+			}
+			w.Write([]byte(body + `</body></html>`))
+		case "/dated":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`<html><head><title>Dated</title></head><body><a href="/leaf">Leaf</a></body></html>`))
+		case "/sitemap.xml":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(`<html><body>Plain</body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := New(db, metrics.NewNoopMetrics())
+	startURL, _ := url.Parse(ts.URL + "/")
+	crawl := func(opts Options) (*Result, map[string]database.PageData) {
+		result, err := c.Start(context.Background(), startURL, opts)
+		if err != nil {
+			t.Fatalf("Crawl failed: %v", err)
+		}
+		pages, err := db.GetPages()
+		if err != nil {
+			t.Fatalf("GetPages() error = %v", err)
+		}
+		crawled := make(map[string]database.PageData)
+		for _, page := range pages {
+			crawled[strings.TrimPrefix(page.URL, ts.URL)] = page
+		}
+		return result, crawled
+	}
+
+	_, pages := crawl(Options{})
+	if root := pages["/"]; root.ETag != `"v1"` || root.Unchanged {
+		t.Errorf("Expected / to be stored with its ETag, got %+v", root)
+	}
+	if dated := pages["/dated"]; dated.LastModified != lastModified {
+		t.Errorf("Expected /dated to be stored with its Last-Modified, got %+v", dated)
+	}
+	if len(conditional) != 0 {
+		t.Errorf("Expected no conditional requests on the first crawl, got %v", conditional)
+	}
+
+	result, pages := crawl(Options{})
+	for _, path := range []string{"/", "/dated"} {
+		page := pages[path]
+		if !page.Unchanged || page.JobID != result.JobID || page.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to be unchanged in job %d, got %+v", path, result.JobID, page)
+		}
+		if conditional[path] != 1 {
+			t.Errorf("Expected %s to be requested conditionally once, got %d", path, conditional[path])
+		}
+	}
+	if title := pages["/"].Title; title != "Home" {
+		t.Errorf("Expected the stored title to be kept, got %q", title)
+	}
+	for _, path := range []string{"/plain", "/leaf"} {
+		page, ok := pages[path]
+		if !ok || page.Unchanged || page.JobID != result.JobID {
+			t.Errorf("Expected %s to be fetched again through the stored links, got %+v", path, page)
+		}
+	}
+	outlinks, err := db.GetOutlinks(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GetOutlinks() error = %v", err)
+	}
+	if len(outlinks) != 2 || outlinks[0].JobID != result.JobID {
+		t.Errorf("Expected the stored links of / to move to job %d, got %+v", result.JobID, outlinks)
+	}
+
+	mu.Lock()
+	version = "v2"
+	mu.Unlock()
+	_, pages = crawl(Options{})
+	if root := pages["/"]; root.Unchanged || root.ETag != `"v2"` {
+		t.Errorf("Expected the changed / to be fetched in full, got %+v", root)
+	}
+	if _, ok := pages["/new"]; !ok {
+		t.Error("Expected the link added to / to be crawled")
+	}
+
+	clear(conditional)
+	_, pages = crawl(Options{FullRecrawl: true})
+	if len(conditional) != 0 {
+		t.Errorf("Expected no conditional requests with FullRecrawl, got %v", conditional)
+	}
+	if dated := pages["/dated"]; dated.Unchanged {
+		t.Errorf("Expected /dated to be fetched in full, got %+v", dated)
+	}
+
+	history, err := db.GetPageHistory(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GetPageHistory() error = %v", err)
+	}
+	if len(history) != 4 || history[0].Unchanged || !history[1].Unchanged || history[2].Unchanged {
+		t.Errorf("Expected a snapshot of / per crawl, unchanged in the second, got %+v", history)
+	}
+}
+
+// recordingNotifier records the jobs it is told about.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	jobs []database.CrawlJob
+}
+
+func (n *recordingNotifier) JobFinished(job database.CrawlJob) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.jobs = append(n.jobs, job)
+}
+
+func TestCrawlerNotifier(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/sitemap.xml":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(`<html><body>Page</body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	n := &recordingNotifier{}
+	c := New(db, metrics.NewNoopMetrics(), WithNotifier(n))
+
+	startURL, _ := url.Parse(ts.URL + "/")
+	completed, err := c.Start(context.Background(), startURL, Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	// A start URL disallowed by robots.txt fails the job
+	blockedURL, _ := url.Parse(ts.URL + "/private")
+	if _, err := c.Start(context.Background(), blockedURL, Options{}); err == nil {
+		t.Fatalf("Expected the blocked crawl to fail")
+	}
+	// Paused jobs are not finished
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrPaused)
+	if _, err := c.Start(ctx, startURL, Options{}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.jobs) != 2 {
+		t.Fatalf("Expected 2 finished jobs, got %+v", n.jobs)
+	}
+	if job := n.jobs[0]; job.ID != completed.JobID || job.State != database.JobCompleted {
+		t.Errorf("Expected job %d to complete, got %+v", completed.JobID, job)
+	}
+	if job := n.jobs[1]; job.State != database.JobFailed || job.Error == "" {
+		t.Errorf("Expected the blocked job to fail, got %+v", job)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	crawlerFlags := AddFlags(fs)
+	optionsFlags := AddOptionsFlags(fs, true)
+	err := fs.Parse([]string{
+		"-workers=3", "-strip-params=utm_*, ,ref", "-sort-query=false",
+		"-max-pages=10", "-sitemaps=false", "-exclude=/admin/**", "-exclude=re:\\?print",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	c := New(nil, metrics.NewNoopMetrics(), crawlerFlags.CrawlerOptions()...)
+	if c.workers != 3 || c.retries != DefaultRetries {
+		t.Errorf("Expected 3 workers and %d retries, got %d and %d", DefaultRetries, c.workers, c.retries)
+	}
+	if got := strings.Join(c.normalizer.StripParams, ","); got != "utm_*,ref" || c.normalizer.SortQuery {
+		t.Errorf("Unexpected normalizer settings: strip %q, sort %v", got, c.normalizer.SortQuery)
+	}
+
+	opts := optionsFlags.Options()
+	if opts.MaxPages != 10 || !opts.SkipSitemaps || !opts.CheckExternal || !opts.CheckAssets {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	if len(opts.Exclude) != 2 || opts.Exclude[1] != "re:\\?print" {
+		t.Errorf("Expected 2 exclude patterns, got %v", opts.Exclude)
+	}
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"spiderlite/internal/database"
+)
+
+var (
+	errRobotsBlocked = errors.New("disallowed by robots.txt")
+	errBodyTooLarge  = errors.New("response body too large")
+	// Redirect errors are returned by checkRedirect.
+	errRedirectLoop     = errors.New("redirect loop")
+	errTooManyRedirects = errors.New("too many redirects")
+)
+
+// classifyError returns the database error category of a failed fetch.
+func classifyError(err error) string {
+	var (
+		dnsErr       *net.DNSError
+		certErr      *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		netErr       net.Error
+	)
+
+	switch {
+	case errors.Is(err, errRobotsBlocked):
+		return database.ErrorRobotsBlocked
+	case errors.Is(err, errBodyTooLarge):
+		return database.ErrorBodyTooLarge
+	case errors.Is(err, errRedirectLoop):
+		return database.ErrorRedirectLoop
+	case errors.Is(err, errTooManyRedirects):
+		return database.ErrorTooManyRedirects
+	case errors.As(err, &dnsErr):
+		return database.ErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return database.ErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return database.ErrorConnectionReset
+	case errors.As(err, &certErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		strings.Contains(err.Error(), "tls: "):
+		return database.ErrorTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return database.ErrorTimeout
+	default:
+		return database.ErrorNetwork
+	}
+}
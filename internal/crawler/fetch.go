@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"spiderlite/internal/database"
+)
+
+// Default retry policy for failed requests.
+const (
+	DefaultRetries      = 2
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// maxRetryDelay caps the wait before a retry, including delays asked for by
+// Retry-After headers.
+const maxRetryDelay = time.Minute
+
+// fetch requests u with the given method and extra headers, retrying
+// network errors, 429 and 5xx responses with jittered exponential backoff.
+// It returns the last response or error along with the number of attempts
+// made. Closing the response body releases the host's connection slot.
+func (c *Crawler) fetch(ctx context.Context, method string, u *url.URL, header http.Header) (*http.Response, int, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.do(ctx, method, u, header)
+		if attempt > c.retries || ctx.Err() != nil || !retryable(resp, err) {
+			return resp, attempt, err
+		}
+
+		delay := c.retryDelay(attempt, resp)
+		if err != nil {
+			log.Printf("Request to %s failed, retrying in %s: %v", u.String(), delay, err)
+		} else {
+			resp.Body.Close()
+			log.Printf("Request to %s returned %s, retrying in %s", u.String(), resp.Status, delay)
+		}
+		c.metrics.IncrementRetries(u.Host)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do makes a single request for u once the host limiter allows it.
+func (c *Crawler) do(ctx context.Context, method string, u *url.URL, header http.Header) (*http.Response, error) {
+	// Only the last attempt is traced
+	trace := traceFrom(ctx)
+	if trace != nil {
+		*trace = requestTrace{}
+	}
+
+	// Wait for our turn before starting the request timeout
+	release, err := c.limiter.acquire(ctx, u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	sent := time.Now()
+	resp, err := c.client.Do(req)
+	if trace != nil {
+		trace.responseTime = time.Since(sent)
+	}
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() {
+		cancel()
+		release()
+	}}
+	return resp, nil
+}
+
+// requestTrace collects what happened during a request: the redirects it
+// followed and the time taken to receive the response headers.
+type requestTrace struct {
+	hops         []database.RedirectHop
+	responseTime time.Duration
+}
+
+type requestTraceKey struct{}
+
+// withTrace returns a context recording the requests made with it into
+// trace.
+func withTrace(ctx context.Context, trace *requestTrace) context.Context {
+	return context.WithValue(ctx, requestTraceKey{}, trace)
+}
+
+func traceFrom(ctx context.Context) *requestTrace {
+	trace, _ := ctx.Value(requestTraceKey{}).(*requestTrace)
+	return trace
+}
+
+// retryable reports whether a request failed in a way worth retrying.
+func retryable(resp *http.Response, err error) bool {
+	if errors.Is(err, errRedirectLoop) || errors.Is(err, errTooManyRedirects) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryDelay returns the wait before the retry following the given attempt:
+// an exponential backoff with jitter, or the Retry-After delay of resp if
+// longer.
+func (c *Crawler) retryDelay(attempt int, resp *http.Response) time.Duration {
+	backoff := c.retryBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > maxRetryDelay {
+		backoff = maxRetryDelay
+	}
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok && after > delay {
+			delay = after
+		}
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// readBody reads the body of resp, failing with errBodyTooLarge past limit
+// bytes unless limit is zero.
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	tooLarge := fmt.Errorf("%w: over %d bytes", errBodyTooLarge, limit)
+	if limit > 0 && resp.ContentLength > limit {
+		return nil, tooLarge
+	}
+
+	var reader io.Reader = resp.Body
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, tooLarge
+	}
+	return body, nil
+}
+
+// releaseBody runs release once the response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"spiderlite/internal/parser"
+)
+
+// Flags binds the settings of a Crawler to command-line flags, so every
+// command running crawls accepts the same ones.
+type Flags struct {
+	workers        *int
+	minDelay       *time.Duration
+	maxHostConns   *int
+	userAgent      *string
+	robotsToken    *string
+	requestTimeout *time.Duration
+	retries        *int
+	retryBackoff   *time.Duration
+	maxRedirects   *int
+	maxBodySize    *int64
+	stripParams    *string
+	sortQuery      *bool
+}
+
+// AddFlags defines the crawler settings flags on fs.
+func AddFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		workers:        fs.Int("workers", DefaultWorkers, "Number of pages fetched concurrently per crawl"),
+		minDelay:       fs.Duration("min-delay", 0, "Minimum delay between two requests to the same host"),
+		maxHostConns:   fs.Int("max-host-conns", 0, "Maximum concurrent requests to the same host (0 for no limit)"),
+		userAgent:      fs.String("user-agent", DefaultUserAgent, "User-Agent header sent with every request"),
+		robotsToken:    fs.String("robots-token", DefaultRobotsToken, "Name matched against robots.txt User-agent groups"),
+		requestTimeout: fs.Duration("request-timeout", DefaultRequestTimeout, "Timeout of each page request"),
+		retries:        fs.Int("retries", DefaultRetries, "Retries of requests failing with a network error, 429 or 5xx"),
+		retryBackoff:   fs.Duration("retry-backoff", DefaultRetryBackoff, "Base delay before retrying a request, doubled on each retry"),
+		maxRedirects:   fs.Int("max-redirects", DefaultMaxRedirects, "Maximum redirects followed for a page (0 to not follow redirects)"),
+		maxBodySize:    fs.Int64("max-body-size", DefaultMaxBodySize, "Maximum size of the page bodies read, in bytes (0 for no limit)"),
+		stripParams:    fs.String("strip-params", strings.Join(parser.DefaultStripParams, ","), "Comma-separated query parameters removed from URLs, e.g. utm_*"),
+		sortQuery:      fs.Bool("sort-query", true, "Sort query parameters so URLs differing only by their order are crawled once"),
+	}
+}
+
+// CrawlerOptions returns the crawler settings given by the flags.
+func (f *Flags) CrawlerOptions() []Option {
+	return []Option{
+		WithWorkers(*f.workers),
+		WithMinDelay(*f.minDelay),
+		WithMaxHostConns(*f.maxHostConns),
+		WithUserAgent(*f.userAgent),
+		WithRobotsToken(*f.robotsToken),
+		WithRequestTimeout(*f.requestTimeout),
+		WithRetries(*f.retries),
+		WithRetryBackoff(*f.retryBackoff),
+		WithMaxBodySize(*f.maxBodySize),
+		WithMaxRedirects(*f.maxRedirects),
+		WithStripParams(splitList(*f.stripParams)),
+		WithSortQuery(*f.sortQuery),
+	}
+}
+
+// OptionsFlags binds the limits and scope of a crawl to command-line flags.
+type OptionsFlags struct {
+	maxDepth       *int
+	maxPages       *int
+	maxDuration    *time.Duration
+	sitemaps       *bool
+	checkExternal  *bool
+	checkAssets    *bool
+	ignoreNoFollow *bool
+	fullRecrawl    *bool
+	subdomains     *bool
+	allowHosts     listFlag
+	pathPrefixes   listFlag
+	include        listFlag
+	exclude        listFlag
+}
+
+// AddOptionsFlags defines the crawl limit and scope flags on fs. check is
+// the default of the -check-external and -check-assets flags.
+func AddOptionsFlags(fs *flag.FlagSet, check bool) *OptionsFlags {
+	f := &OptionsFlags{
+		maxDepth:       fs.Int("max-depth", 0, "Maximum number of links followed from the start URL (0 for no limit)"),
+		maxPages:       fs.Int("max-pages", 0, "Maximum number of pages fetched (0 for no limit)"),
+		maxDuration:    fs.Duration("max-duration", 0, "Maximum crawl duration, e.g. 10m (0 for no limit)"),
+		sitemaps:       fs.Bool("sitemaps", true, "Seed the crawl with the URLs listed in the site's sitemaps"),
+		checkExternal:  fs.Bool("check-external", check, "Check the external links found once the crawl ends"),
+		checkAssets:    fs.Bool("check-assets", check, "Check the images, scripts and other assets found once the crawl ends"),
+		ignoreNoFollow: fs.Bool("ignore-nofollow", false, "Follow nofollow links and the links of nofollow pages"),
+		fullRecrawl:    fs.Bool("full-recrawl", false, "Fetch every page in full instead of only the pages changed since the last crawl"),
+		subdomains:     fs.Bool("subdomains", false, "Also crawl the subdomains of the allowed hosts"),
+	}
+	fs.Var(&f.allowHosts, "allow-host", "Host to crawl, defaults to the start URL's host (repeatable)")
+	fs.Var(&f.pathPrefixes, "path-prefix", "Only crawl URLs whose path starts with this prefix (repeatable)")
+	fs.Var(&f.include, "include", "Only crawl URLs matching this glob, or regex when prefixed with re: (repeatable)")
+	fs.Var(&f.exclude, "exclude", "Skip URLs matching this glob, or regex when prefixed with re: (repeatable)")
+	return f
+}
+
+// Options returns the crawl limits and scope given by the flags.
+func (f *OptionsFlags) Options() Options {
+	return Options{
+		MaxDepth:       *f.maxDepth,
+		MaxPages:       *f.maxPages,
+		MaxDuration:    *f.maxDuration,
+		SkipSitemaps:   !*f.sitemaps,
+		CheckExternal:  *f.checkExternal,
+		CheckAssets:    *f.checkAssets,
+		IgnoreNoFollow: *f.ignoreNoFollow,
+		FullRecrawl:    *f.fullRecrawl,
+
+		AllowedHosts:      f.allowHosts,
+		IncludeSubdomains: *f.subdomains,
+		PathPrefixes:      f.pathPrefixes,
+		Include:           f.include,
+		Exclude:           f.exclude,
+	}
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listFlag collects the values of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
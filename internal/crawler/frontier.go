@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"log"
+	"net/url"
+	"sync"
+
+	"spiderlite/internal/database"
+)
+
+// item is a URL waiting in the frontier along with its distance in links
+// from the seed, how it was discovered and the page it was found on.
+type item struct {
+	url    *url.URL
+	depth  int
+	source string
+	parent string
+}
+
+// frontier is the shared queue of URLs waiting to be fetched by the workers.
+// It also tracks every URL ever enqueued so each page is crawled only once.
+// When db is set, every URL and its state is persisted under the crawl job
+// so an interrupted crawl can be resumed.
+type frontier struct {
+	db    *database.DB
+	jobID int64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []item
+	seen     map[string]struct{}
+	inflight int
+	popped   int
+	maxPages int
+	stopped  StopReason
+}
+
+func newFrontier(db *database.DB, jobID int64, maxPages int) *frontier {
+	f := &frontier{
+		db:       db,
+		jobID:    jobID,
+		seen:     make(map[string]struct{}),
+		maxPages: maxPages,
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// restore loads the persisted frontier of an interrupted crawl. URLs that
+// were queued or in flight are queued again, the others are only marked as
+// seen. The pages already processed count towards maxPages. It reports the
+// number of URLs queued.
+func (f *frontier) restore() (int, error) {
+	entries, err := f.db.GetFrontier(f.jobID)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, entry := range entries {
+		f.seen[entry.URL] = struct{}{}
+		switch entry.State {
+		case database.FrontierDone, database.FrontierFailed:
+			f.popped++
+			continue
+		case database.FrontierQueued, database.FrontierInFlight:
+		default:
+			continue
+		}
+		u, err := url.Parse(entry.URL)
+		if err != nil {
+			continue
+		}
+		f.queue = append(f.queue, item{url: u, depth: entry.Depth, source: entry.Source, parent: entry.Parent})
+	}
+	return len(f.queue), nil
+}
+
+// push enqueues u unless it has already been seen. The depth, source, parent
+// and sitemap metadata are taken from entry. It reports whether the URL was
+// added.
+func (f *frontier) push(u *url.URL, entry database.FrontierEntry) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Persist before the URL becomes visible to the workers so its state
+	// updates always find the row.
+	entry.State = database.FrontierQueued
+	if !f.add(u, entry) {
+		return false
+	}
+
+	f.queue = append(f.queue, item{url: u, depth: entry.Depth, source: entry.Source, parent: entry.Parent})
+	f.cond.Signal()
+	return true
+}
+
+// record marks u as discovered with the state of entry, without queueing
+// it, unless it has already been seen.
+func (f *frontier) record(u *url.URL, entry database.FrontierEntry) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.add(u, entry)
+}
+
+// add marks u as seen and persists entry. f.mu must be held.
+func (f *frontier) add(u *url.URL, entry database.FrontierEntry) bool {
+	key := u.String()
+	if _, ok := f.seen[key]; ok {
+		return false
+	}
+	f.seen[key] = struct{}{}
+
+	if f.db != nil {
+		entry.URL = key
+		if err := f.db.EnqueueURL(f.jobID, entry); err != nil {
+			log.Printf("Failed to persist frontier URL %s: %v", key, err)
+		}
+	}
+	return true
+}
+
+// pop blocks until a URL is available or the crawl is finished, meaning the
+// queue is empty and no worker is still processing a page, or the crawl was
+// stopped. Every successful pop must be followed by a call to done.
+func (f *frontier) pop() (item, bool) {
+	f.mu.Lock()
+	for {
+		if f.stopped != "" {
+			f.mu.Unlock()
+			return item{}, false
+		}
+		if len(f.queue) > 0 {
+			break
+		}
+		if f.inflight == 0 {
+			f.mu.Unlock()
+			return item{}, false
+		}
+		f.cond.Wait()
+	}
+	if f.maxPages > 0 && f.popped >= f.maxPages {
+		f.stopped = StopMaxPages
+		f.cond.Broadcast()
+		f.mu.Unlock()
+		return item{}, false
+	}
+
+	it := f.queue[0]
+	f.queue[0] = item{}
+	f.queue = f.queue[1:]
+	f.inflight++
+	f.popped++
+	f.mu.Unlock()
+
+	f.setState(it.url, database.FrontierInFlight)
+	return it, true
+}
+
+// done marks a popped URL as processed, recording whether it failed.
+func (f *frontier) done(u *url.URL, failed bool) {
+	state := database.FrontierDone
+	if failed {
+		state = database.FrontierFailed
+	}
+	f.setState(u, state)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.inflight--
+	if f.inflight == 0 && len(f.queue) == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// requeue puts back a popped URL whose processing was interrupted, leaving it
+// queued in the database. The in-memory queue is not refilled since the
+// crawl is stopping.
+func (f *frontier) requeue(u *url.URL) {
+	f.setState(u, database.FrontierQueued)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.popped--
+	f.inflight--
+	if f.inflight == 0 && len(f.queue) == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// stop makes the workers exit once their current page is processed. The
+// first reason given wins.
+func (f *frontier) stop(reason StopReason) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stopped == "" {
+		f.stopped = reason
+	}
+	f.cond.Broadcast()
+}
+
+// stopReason returns why the crawl ended, once every worker has exited.
+func (f *frontier) stopReason() StopReason {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stopped != "" {
+		return f.stopped
+	}
+	return StopCompleted
+}
+
+// pages returns the number of URLs handed out to the workers, including
+// those processed before the crawl was resumed.
+func (f *frontier) pages() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.popped
+}
+
+func (f *frontier) setState(u *url.URL, state string) {
+	if f.db == nil {
+		return
+	}
+	if err := f.db.SetFrontierState(f.jobID, u.String(), state); err != nil {
+		log.Printf("Failed to update frontier state for %s: %v", u.String(), err)
+	}
+}
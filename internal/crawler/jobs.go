@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"spiderlite/internal/database"
+)
+
+var (
+	// ErrPaused is the cancellation cause that pauses a running job instead
+	// of cancelling it.
+	ErrPaused = errors.New("crawl paused")
+	// ErrCancelled is the cancellation cause of jobs cancelled by a user.
+	ErrCancelled = errors.New("crawl cancelled")
+	// ErrShutdown is the cancellation cause of jobs interrupted because the
+	// process is stopping. They are queued again to resume on restart.
+	ErrShutdown = errors.New("crawler shutting down")
+
+	// ErrJobNotActive is returned when cancelling or pausing a job that has
+	// already finished.
+	ErrJobNotActive = errors.New("job is not active")
+	// ErrJobNotPaused is returned when resuming a job that is not paused.
+	ErrJobNotPaused = errors.New("job is not paused")
+	// ErrJobRunning is returned when launching a job that is still running.
+	ErrJobRunning = errors.New("job is still running")
+)
+
+// cancelReason maps the cancellation cause of a crawl context to the reason
+// the crawl stopped.
+func cancelReason(ctx context.Context) StopReason {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrPaused):
+		return StopPaused
+	case errors.Is(cause, ErrShutdown):
+		return StopInterrupted
+	default:
+		return StopCancelled
+	}
+}
+
+// Submit creates a crawl job for startURL and runs it in the background. It
+// returns the ID of the new job.
+func (c *Crawler) Submit(startURL *url.URL, opts Options) (int64, error) {
+	jobID, err := c.createJob(startURL, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.launch(jobID, startURL, opts); err != nil {
+		return 0, err
+	}
+	return jobID, nil
+}
+
+// ResumeOrStart resumes the last job of startURL that was interrupted, with
+// the options it was created with, blocking like Start. If there is none, it
+// starts a new job like Start.
+func (c *Crawler) ResumeOrStart(ctx context.Context, startURL *url.URL, opts Options) (*Result, error) {
+	job, err := c.db.UnfinishedJob(c.normalizer.Normalize(startURL).String())
+	if errors.Is(err, database.ErrNotFound) {
+		return c.Start(ctx, startURL, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	startURL, opts, err = jobParams(*job)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Resuming interrupted crawl job %d for: %s", job.ID, startURL.String())
+	return c.Run(ctx, job.ID, startURL, opts)
+}
+
+// ResumeJobs restarts in the background every job that was queued or
+// running when the process stopped.
+func (c *Crawler) ResumeJobs() error {
+	jobs, err := c.db.UnfinishedJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		err := c.resume(job)
+		if errors.Is(err, ErrJobRunning) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failing unresumable job %d: %v", job.ID, err)
+			if err := c.db.FinishJob(job.ID, database.JobFailed, "", err.Error()); err != nil {
+				log.Printf("Failed to record failure of job %d: %v", job.ID, err)
+			}
+			c.notify(job.ID)
+		}
+	}
+	return nil
+}
+
+// Cancel stops a job for good, aborting the requests in flight if it is
+// running.
+func (c *Crawler) Cancel(jobID int64) error {
+	if c.interrupt(jobID, ErrCancelled) {
+		return nil
+	}
+
+	job, err := c.db.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	if job.State != database.JobQueued && job.State != database.JobPaused {
+		return ErrJobNotActive
+	}
+
+	if err := c.db.SkipQueued(jobID); err != nil {
+		return err
+	}
+	return c.db.FinishJob(jobID, database.JobCancelled, string(StopCancelled), "")
+}
+
+// Pause suspends a running job. Pages whose requests were in flight are
+// queued again, and the frontier is kept so Resume continues where it
+// stopped.
+func (c *Crawler) Pause(jobID int64) error {
+	if c.interrupt(jobID, ErrPaused) {
+		return nil
+	}
+
+	if _, err := c.db.GetJob(jobID); err != nil {
+		return err
+	}
+	return ErrJobNotActive
+}
+
+// Resume continues a paused job in the background.
+func (c *Crawler) Resume(jobID int64) error {
+	job, err := c.db.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	if job.State != database.JobPaused {
+		return ErrJobNotPaused
+	}
+	return c.resume(*job)
+}
+
+func (c *Crawler) resume(job database.CrawlJob) error {
+	startURL, opts, err := jobParams(job)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Resuming crawl job %d for: %s", job.ID, startURL.String())
+	return c.launch(job.ID, startURL, opts)
+}
+
+// runningJob is the handle of a job running in the background.
+type runningJob struct {
+	cancel context.CancelCauseFunc
+}
+
+// launch runs a job in the background, registering it so it can be
+// interrupted. It returns ErrJobRunning if the job is already running.
+func (c *Crawler) launch(jobID int64, startURL *url.URL, opts Options) error {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	job := &runningJob{cancel: cancel}
+
+	c.mu.Lock()
+	if _, ok := c.running[jobID]; ok {
+		c.mu.Unlock()
+		cancel(nil)
+		return ErrJobRunning
+	}
+	c.running[jobID] = job
+	c.mu.Unlock()
+
+	// The job is unregistered before its outcome is saved, so it can be
+	// resumed as soon as it is seen paused
+	unregister := func() {
+		c.mu.Lock()
+		if c.running[jobID] == job {
+			delete(c.running, jobID)
+		}
+		c.mu.Unlock()
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			unregister()
+			cancel(nil)
+		}()
+
+		if _, err := c.runJob(ctx, jobID, startURL, opts, unregister); err != nil {
+			log.Printf("Crawl job %d error: %v", jobID, err)
+			c.metrics.IncrementCrawlErrors()
+		}
+	}()
+	return nil
+}
+
+// interrupt cancels a running job with the given cause. It reports whether
+// the job was running.
+func (c *Crawler) interrupt(jobID int64, cause error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.running[jobID]
+	if ok {
+		job.cancel(cause)
+	}
+	return ok
+}
+
+// Shutdown interrupts every running job, keeping their frontier so they are
+// resumed by ResumeJobs on the next start, and waits for them to stop or for
+// ctx to be done.
+func (c *Crawler) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	for _, job := range c.running {
+		job.cancel(ErrShutdown)
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("running crawls did not stop in time: %v", ctx.Err())
+	}
+}
+
+func (c *Crawler) createJob(startURL *url.URL, opts Options) (int64, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	seed := c.normalizer.Normalize(startURL)
+	jobID, err := c.db.CreateJob(seed.String(), encoded)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create crawl job: %v", err)
+	}
+	return jobID, nil
+}
+
+// jobParams decodes the seed and options stored on a job.
+func jobParams(job database.CrawlJob) (*url.URL, Options, error) {
+	var opts Options
+
+	startURL, err := url.Parse(job.Seed)
+	if err != nil {
+		return nil, opts, fmt.Errorf("invalid seed: %v", err)
+	}
+	if len(job.Options) > 0 {
+		if err := json.Unmarshal(job.Options, &opts); err != nil {
+			return nil, opts, fmt.Errorf("invalid options: %v", err)
+		}
+	}
+	return startURL, opts, nil
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"spiderlite/internal/database"
+)
+
+// CheckExternalLinks requests every external link target that was not
+// crawled, so that broken link reports cover links to other sites. Targets
+// are checked with HEAD requests, falling back to GET for servers that do
+// not support HEAD, and each outcome is stored as a database.LinkCheck. A
+// zero jobID checks the links found by every job. It returns the number of
+// targets checked.
+func (c *Crawler) CheckExternalLinks(ctx context.Context, jobID int64) (int, error) {
+	targets, err := c.db.GetUncrawledExternalLinks(jobID)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Checking %d external links", len(targets))
+	return c.checkLinks(ctx, jobID, targets)
+}
+
+// CheckAssets requests the images, scripts, stylesheets and other assets of
+// the crawled hosts, which are not crawled, like CheckExternalLinks does for
+// external links.
+func (c *Crawler) CheckAssets(ctx context.Context, jobID int64) (int, error) {
+	targets, err := c.db.GetUncrawledAssets(jobID)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Checking %d assets", len(targets))
+	return c.checkLinks(ctx, jobID, targets)
+}
+
+// checkLinks checks targets concurrently for a job and returns the number
+// checked.
+func (c *Crawler) checkLinks(ctx context.Context, jobID int64, targets []string) (int, error) {
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				c.checkLink(ctx, jobID, target)
+			}
+		}()
+	}
+
+	checked := 0
+	for _, target := range targets {
+		select {
+		case queue <- target:
+			checked++
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return checked, ctx.Err()
+}
+
+// checkLink requests target and stores the outcome.
+func (c *Crawler) checkLink(ctx context.Context, jobID int64, target string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+
+	check := database.LinkCheck{URL: target, JobID: jobID}
+	resp, _, err := c.fetch(ctx, http.MethodHead, u, nil)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, _, err = c.fetch(ctx, http.MethodGet, u, nil)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		check.ErrorCategory = classifyError(err)
+		check.ErrorMessage = err.Error()
+	} else {
+		// Drain a little of the body so the connection can be reused
+		io.CopyN(io.Discard, resp.Body, 4<<10)
+		resp.Body.Close()
+		check.StatusCode = resp.StatusCode
+	}
+	check.CheckedAt = time.Now()
+
+	if err := c.db.StoreLinkCheck(check); err != nil {
+		log.Printf("Failed to store check of %s: %v", target, err)
+	}
+}
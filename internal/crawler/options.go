@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+)
+
+// Options are the per-crawl settings passed to Crawler.Start. Zero values
+// mean no limit.
+type Options struct {
+	// MaxDepth is the maximum number of links followed from the seed URL.
+	MaxDepth int `json:"max_depth,omitempty"`
+	// MaxPages is the maximum number of pages fetched.
+	MaxPages int `json:"max_pages,omitempty"`
+	// MaxDuration is the maximum wall-clock time spent crawling.
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	// SkipSitemaps disables seeding the crawl with the URLs listed in the
+	// site's sitemaps.
+	SkipSitemaps bool `json:"skip_sitemaps,omitempty"`
+	// CheckExternal requests the external links found once the crawl ends,
+	// so broken link reports cover them.
+	CheckExternal bool `json:"check_external,omitempty"`
+	// CheckAssets requests the images, scripts, stylesheets and other
+	// assets of the crawled hosts once the crawl ends. Assets are not
+	// crawled.
+	CheckAssets bool `json:"check_assets,omitempty"`
+	// IgnoreNoFollow follows links marked rel="nofollow" and the links of
+	// pages with a nofollow robots meta tag or X-Robots-Tag header. The
+	// directives are recorded on pages either way.
+	IgnoreNoFollow bool `json:"ignore_nofollow,omitempty"`
+	// FullRecrawl fetches every page in full. By default, pages stored with
+	// an ETag or Last-Modified validator are requested conditionally and
+	// kept as they are when unchanged.
+	FullRecrawl bool `json:"full_recrawl,omitempty"`
+
+	// AllowedHosts are the hosts crawled, with or without a port. It
+	// defaults to the host of the seed URL.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	// IncludeSubdomains also crawls the subdomains of the allowed hosts.
+	IncludeSubdomains bool `json:"include_subdomains,omitempty"`
+	// PathPrefixes restricts the crawl to URLs whose path starts with one
+	// of the prefixes.
+	PathPrefixes []string `json:"path_prefixes,omitempty"`
+	// Include restricts the crawl to URLs matching one of the patterns and
+	// Exclude skips URLs matching any of them. Patterns are globs matched
+	// against the URL path, where "*" stays within a path segment and "**"
+	// does not, or regular expressions matched against the path and query
+	// when prefixed with "re:".
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Validate checks that the scope patterns of the options compile.
+func (o Options) Validate() error {
+	_, err := newScope(&url.URL{}, o)
+	return err
+}
+
+// StopReason explains why a crawl ended.
+type StopReason string
+
+const (
+	StopCompleted   StopReason = "completed"
+	StopMaxPages    StopReason = "max_pages"
+	StopMaxDuration StopReason = "max_duration"
+	StopPaused      StopReason = "paused"
+	StopCancelled   StopReason = "cancelled"
+	StopInterrupted StopReason = "interrupted"
+)
+
+// Result summarizes a finished crawl.
+type Result struct {
+	JobID      int64
+	Pages      int
+	Duration   time.Duration
+	StopReason StopReason
+}
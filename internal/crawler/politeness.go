@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxCrawlDelay caps the Crawl-delay honored, so a robots.txt asking for
+// hours between requests cannot stall a crawl.
+const maxCrawlDelay = time.Minute
+
+// hostLimiter spaces out requests to the same host and caps the number of
+// concurrent connections to it. It is shared by every crawl of a Crawler so
+// concurrent crawls of one site stay polite too.
+type hostLimiter struct {
+	minDelay time.Duration
+	maxConns int
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots chan struct{}
+
+	mu    sync.Mutex
+	delay time.Duration
+	next  time.Time
+}
+
+func newHostLimiter(minDelay time.Duration, maxConns int) *hostLimiter {
+	return &hostLimiter{
+		minDelay: minDelay,
+		maxConns: maxConns,
+		hosts:    make(map[string]*hostState),
+	}
+}
+
+func (l *hostLimiter) host(host string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostState{delay: l.minDelay}
+		if l.maxConns > 0 {
+			h.slots = make(chan struct{}, l.maxConns)
+		}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// setCrawlDelay applies the Crawl-delay requested by the host's robots.txt,
+// capped to maxCrawlDelay. The configured minimum delay still applies if it
+// is longer. The next request is rescheduled with the new delay, since the
+// robots.txt request itself was spaced with the previous one.
+func (l *hostLimiter) setCrawlDelay(host string, delay time.Duration) {
+	h := l.host(host)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delay = max(l.minDelay, min(delay, maxCrawlDelay))
+	if !h.next.IsZero() {
+		h.next = h.next.Add(delay - h.delay)
+	}
+	h.delay = delay
+}
+
+// acquire blocks until a request to host may be sent or ctx is done. The
+// returned function must be called once the response has been consumed.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (release func(), err error) {
+	h := l.host(host)
+
+	release = func() {}
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-h.slots }
+	}
+
+	h.mu.Lock()
+	now := time.Now()
+	wait := h.next.Sub(now)
+	h.next = now.Add(max(wait, 0) + h.delay)
+	h.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
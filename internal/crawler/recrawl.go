@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"spiderlite/internal/database"
+	"spiderlite/internal/parser"
+)
+
+// cachedPage returns the stored page of u when it can be requested
+// conditionally: it was fetched successfully with an ETag or Last-Modified
+// validator and the crawl does not ask for a full recrawl.
+func (c *Crawler) cachedPage(r *crawlRun, u *url.URL) *database.PageData {
+	if r.opts.FullRecrawl {
+		return nil
+	}
+	page, err := c.db.GetPage(u.String())
+	if err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			log.Printf("Failed to load stored page %s: %v", u.String(), err)
+		}
+		return nil
+	}
+	if page.StatusCode != http.StatusOK || page.ErrorCategory != "" {
+		return nil
+	}
+	if page.ETag == "" && page.LastModified == "" {
+		return nil
+	}
+	return page
+}
+
+// conditionalHeader returns the headers asking for the page only if it
+// changed since it was stored, or nil without a stored page.
+func conditionalHeader(cached *database.PageData) http.Header {
+	if cached == nil {
+		return nil
+	}
+	header := make(http.Header)
+	if cached.ETag != "" {
+		header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return header
+}
+
+// crawlUnchanged handles a 304 Not Modified response: the stored page is
+// kept without reading or parsing a body, and the links stored for it are
+// followed again.
+func (c *Crawler) crawlUnchanged(r *crawlRun, it item, cached *database.PageData, attempts int, trace *requestTrace, resp *http.Response) error {
+	u := it.url
+	err := c.db.MarkPageUnchanged(database.PageData{
+		URL:          u.String(),
+		CrawledAt:    time.Now(),
+		JobID:        r.jobID,
+		Attempts:     attempts,
+		ResponseTime: trace.responseTime,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		log.Printf("Failed to store unchanged page %s: %v", u.String(), err)
+		return err
+	}
+	log.Printf("Page unchanged since the last crawl: %s", u.String())
+	c.metrics.IncrementPagesProcessed(resp.StatusCode, u.Host)
+
+	stored, err := c.db.ReuseLinks(u.String(), r.jobID)
+	if err != nil {
+		log.Printf("Failed to load links of %s: %v", u.String(), err)
+		return err
+	}
+	if cached.NoFollow && !r.opts.IgnoreNoFollow {
+		log.Printf("Not following links of %s (nofollow)", u.String())
+		return nil
+	}
+
+	var links []*url.URL
+	for _, link := range stored {
+		target, err := url.Parse(link.TargetURL)
+		if err != nil {
+			continue
+		}
+		if r.followable(parser.Link{URL: target, Rel: link.Rel, Kind: parser.LinkKind(link.Kind)}) {
+			links = append(links, target)
+		}
+	}
+	return c.followLinks(r, it, links)
+}
@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"net/http"
+
+	"spiderlite/internal/database"
+)
+
+// DefaultMaxRedirects is the number of redirects followed for a page when
+// none is configured.
+const DefaultMaxRedirects = 10
+
+// checkRedirect records each redirect followed and stops on loops and long
+// chains. It is the CheckRedirect policy of the crawler's HTTP client.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.maxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+
+	if trace := traceFrom(req.Context()); trace != nil {
+		trace.hops = append(trace.hops, database.RedirectHop{
+			Source:     via[len(via)-1].URL.String(),
+			Target:     req.URL.String(),
+			StatusCode: req.Response.StatusCode,
+		})
+	}
+
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return errRedirectLoop
+		}
+	}
+	if len(via) > c.maxRedirects {
+		return errTooManyRedirects
+	}
+	return nil
+}
@@ -1,39 +1,58 @@
 package crawler
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/temoto/robotstxt"
 )
 
 type RobotsChecker struct {
 	robots *robotstxt.RobotsData
+	agent  string
 }
 
-func NewRobotsChecker(baseURL *url.URL) (*RobotsChecker, error) {
-	robotsURL := fmt.Sprintf("%s://%s/robots.txt", baseURL.Scheme, baseURL.Host)
-	robots, err := fetchRobots(robotsURL)
+// fetchRobots fetches the robots.txt of baseURL's host like any other
+// request, rate-limited and bounded by the request timeout. Rules are
+// matched against the group for the crawler's robots token, falling back to
+// "*".
+func (c *Crawler) fetchRobots(ctx context.Context, baseURL *url.URL) (*RobotsChecker, error) {
+	robotsURL := &url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: "/robots.txt"}
+	resp, _, err := c.fetch(ctx, http.MethodGet, robotsURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	return &RobotsChecker{robots: robots}, nil
-}
+	defer resp.Body.Close()
 
-func fetchRobots(robotsURL string) (*robotstxt.RobotsData, error) {
-	resp, err := http.Get(robotsURL)
+	robots, err := robotstxt.FromResponse(resp)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	return robotstxt.FromResponse(resp)
+	return &RobotsChecker{robots: robots, agent: c.robotsToken}, nil
 }
 
 func (r *RobotsChecker) IsAllowed(path string) bool {
-	if r.robots == nil {
+	if r == nil || r.robots == nil {
 		return true
 	}
-	return r.robots.FindGroup("*").Test(path)
+	return r.robots.TestAgent(path, r.agent)
+}
+
+// CrawlDelay returns the delay between requests asked for by robots.txt, or
+// zero if there is none.
+func (r *RobotsChecker) CrawlDelay() time.Duration {
+	if r == nil || r.robots == nil {
+		return 0
+	}
+	return r.robots.FindGroup(r.agent).CrawlDelay
+}
+
+// Sitemaps returns the sitemap URLs listed in robots.txt.
+func (r *RobotsChecker) Sitemaps() []string {
+	if r == nil || r.robots == nil {
+		return nil
+	}
+	return r.robots.Sitemaps
 }
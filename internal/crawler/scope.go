@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks an include or exclude pattern as a regular expression
+// rather than a glob.
+const regexPrefix = "re:"
+
+// scope decides which discovered URLs a crawl fetches, following the scope
+// rules of its Options.
+type scope struct {
+	hosts      []string
+	subdomains bool
+	prefixes   []string
+	include    []pattern
+	exclude    []pattern
+}
+
+// pattern is a compiled include or exclude pattern. Globs are matched
+// against the URL path, regular expressions against the path and query.
+type pattern struct {
+	re    *regexp.Regexp
+	query bool
+}
+
+func (p pattern) match(u *url.URL) bool {
+	if p.query {
+		return p.re.MatchString(u.RequestURI())
+	}
+	return p.re.MatchString(u.EscapedPath())
+}
+
+// newScope compiles the scope rules of opts. When no hosts are allowed
+// explicitly, only the host of startURL is.
+func newScope(startURL *url.URL, opts Options) (*scope, error) {
+	s := &scope{
+		subdomains: opts.IncludeSubdomains,
+		prefixes:   opts.PathPrefixes,
+	}
+	for _, host := range opts.AllowedHosts {
+		s.hosts = append(s.hosts, strings.ToLower(host))
+	}
+	if len(s.hosts) == 0 {
+		s.hosts = []string{strings.ToLower(startURL.Host)}
+	}
+
+	var err error
+	if s.include, err = compilePatterns(opts.Include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compilePatterns(opts.Exclude); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// contains reports whether u is in scope.
+func (s *scope) contains(u *url.URL) bool {
+	if !s.allowsHost(u) {
+		return false
+	}
+	if len(s.prefixes) > 0 && !hasAnyPrefix(u.Path, s.prefixes) {
+		return false
+	}
+	if len(s.include) > 0 && !matchesAny(u, s.include) {
+		return false
+	}
+	return !matchesAny(u, s.exclude)
+}
+
+// allowsHost matches the host of u, with or without its port, against the
+// allowed hosts.
+func (s *scope) allowsHost(u *url.URL) bool {
+	host, hostname := strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	for _, allowed := range s.hosts {
+		if allowed == host || allowed == hostname {
+			return true
+		}
+		if s.subdomains && strings.HasSuffix(hostname, "."+strings.Split(allowed, ":")[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(u *url.URL, patterns []pattern) bool {
+	for _, p := range patterns {
+		if p.match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles include or exclude patterns. Patterns prefixed
+// with "re:" are regular expressions, the others are globs where "*" matches
+// within a path segment and "**" across segments.
+func compilePatterns(patterns []string) ([]pattern, error) {
+	var compiled []pattern
+	for _, p := range patterns {
+		expr, query := globToRegexp(p), false
+		if strings.HasPrefix(p, regexPrefix) {
+			expr, query = strings.TrimPrefix(p, regexPrefix), true
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		compiled = append(compiled, pattern{re: re, query: query})
+	}
+	return compiled, nil
+}
+
+// globToRegexp converts a glob to an anchored regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"spiderlite/internal/parser"
+)
+
+// maxSitemaps bounds the number of sitemaps fetched for a crawl, guarding
+// against huge or looping sitemap indexes.
+const maxSitemaps = 100
+
+// discoverSitemapURLs returns the pages listed in the sitemaps declared in
+// robots.txt, or in /sitemap.xml if there are none. Sitemap indexes are
+// followed. Errors are logged and skipped since sitemaps are optional.
+func (c *Crawler) discoverSitemapURLs(ctx context.Context, startURL *url.URL, robots *RobotsChecker) []parser.SitemapURL {
+	queue := robots.Sitemaps()
+	if len(queue) == 0 {
+		queue = []string{fmt.Sprintf("%s://%s/sitemap.xml", startURL.Scheme, startURL.Host)}
+	}
+
+	var urls []parser.SitemapURL
+	fetched := make(map[string]bool)
+	for len(queue) > 0 && len(fetched) < maxSitemaps {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if fetched[sitemapURL] {
+			continue
+		}
+		fetched[sitemapURL] = true
+
+		sitemap, err := c.fetchSitemap(ctx, sitemapURL)
+		if err != nil {
+			log.Printf("Sitemap error for %s: %v", sitemapURL, err)
+			continue
+		}
+		log.Printf("Found %d URLs and %d sitemaps in %s", len(sitemap.URLs), len(sitemap.Sitemaps), sitemapURL)
+		urls = append(urls, sitemap.URLs...)
+		queue = append(queue, sitemap.Sitemaps...)
+	}
+	return urls
+}
+
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) (*parser.Sitemap, error) {
+	u, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := c.fetch(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return parser.ParseSitemap(resp.Body)
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -13,12 +14,75 @@ import (
 
 type DB struct {
 	*sql.DB
+	historyRetention int
 }
 
 type PageData struct {
 	URL        string
 	StatusCode int
 	CrawledAt  time.Time
+	JobID      int64
+	// Source tells how the page was discovered: SourceSeed, SourceLink or
+	// SourceSitemap.
+	Source string
+	// Attempts is the number of requests made for the page, including
+	// retries.
+	Attempts int
+	// ErrorCategory and ErrorMessage describe why the page could not be
+	// fetched or processed. They are empty on success.
+	ErrorCategory string
+	ErrorMessage  string
+	// FinalURL is the URL the page was served from after following
+	// redirects.
+	FinalURL string
+
+	ContentType   string
+	ContentLength int64
+	// ResponseTime is the time taken to receive the response headers.
+	ResponseTime time.Duration
+	// Depth is the number of links followed from the seed, and ParentURL the
+	// page the URL was first found on.
+	Depth     int
+	ParentURL string
+
+	Title        string
+	Description  string
+	CanonicalURL string
+	Headers      map[string][]string
+	// NoIndex and NoFollow are set when the page's robots meta tags or
+	// X-Robots-Tag headers carry these directives.
+	NoIndex  bool
+	NoFollow bool
+
+	// ETag and LastModified are the validators of the response, sent back
+	// when the page is crawled again.
+	ETag         string
+	LastModified string
+	// Unchanged is set when the last crawl got a 304 Not Modified response
+	// and kept the stored page.
+	Unchanged bool
+}
+
+// Error categories of pages that could not be fetched or processed.
+const (
+	ErrorDNS               = "dns"
+	ErrorConnectionRefused = "connection_refused"
+	ErrorConnectionReset   = "connection_reset"
+	ErrorTLS               = "tls"
+	ErrorTimeout           = "timeout"
+	ErrorBodyTooLarge      = "body_too_large"
+	ErrorRobotsBlocked     = "robots_blocked"
+	ErrorRedirectLoop      = "redirect_loop"
+	ErrorTooManyRedirects  = "too_many_redirects"
+	// ErrorNetwork covers the other transport failures.
+	ErrorNetwork = "network"
+)
+
+// ErrorCategories lists every error category.
+var ErrorCategories = []string{
+	ErrorDNS, ErrorConnectionRefused, ErrorConnectionReset, ErrorTLS,
+	ErrorTimeout, ErrorBodyTooLarge, ErrorRobotsBlocked, ErrorRedirectLoop,
+	ErrorTooManyRedirects, ErrorNetwork,
 }
 
 func NewDB(dbPath string) (*DB, error) {
@@ -33,6 +97,11 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, err
 	}
 
+	// SQLite allows a single writer at a time, and every connection to
+	// ":memory:" opens a separate database, so share one connection between
+	// the crawler workers and the API handlers.
+	db.SetMaxOpenConns(1)
+
 	// Enable foreign keys and WAL mode
 	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
 		return nil, err
@@ -46,44 +115,315 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, historyRetention: DefaultHistoryRetention}, nil
 }
 
-func initSchema(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS pages (
+// Close checkpoints the write-ahead log into the main database file, so no
+// committed write is left pending in the WAL, then closes the database.
+func (db *DB) Close() error {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Printf("WAL checkpoint failed: %v", err)
+	}
+	return db.DB.Close()
+}
+
+// migrations holds the schema changes applied in order. The index of the
+// last applied migration plus one is stored in PRAGMA user_version, so new
+// changes must always be appended.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS pages (
 		url TEXT PRIMARY KEY,
 		status_code INTEGER,
 		crawled_at DATETIME
-	);`
+	);`,
+	`CREATE TABLE IF NOT EXISTS frontier (
+		seed TEXT NOT NULL,
+		url TEXT NOT NULL,
+		state TEXT NOT NULL,
+		updated_at DATETIME,
+		PRIMARY KEY (seed, url)
+	);
+	CREATE INDEX IF NOT EXISTS idx_frontier_state ON frontier (seed, state);`,
+	`ALTER TABLE frontier ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;`,
+	// Crawl jobs replace seeds as the key of the frontier. Unfinished crawls
+	// are turned into queued jobs so they are still resumed.
+	`CREATE TABLE crawl_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		seed TEXT NOT NULL,
+		options TEXT NOT NULL DEFAULT '{}',
+		state TEXT NOT NULL,
+		pages_crawled INTEGER NOT NULL DEFAULT 0,
+		pages_failed INTEGER NOT NULL DEFAULT 0,
+		stop_reason TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	INSERT INTO crawl_jobs (seed, state, created_at)
+		SELECT DISTINCT seed, 'queued', CURRENT_TIMESTAMP
+		FROM frontier
+		WHERE state IN ('queued', 'in_flight');
+	CREATE TABLE frontier_jobs (
+		job_id INTEGER NOT NULL REFERENCES crawl_jobs (id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		depth INTEGER NOT NULL DEFAULT 0,
+		state TEXT NOT NULL,
+		updated_at DATETIME,
+		PRIMARY KEY (job_id, url)
+	);
+	INSERT INTO frontier_jobs (job_id, url, depth, state, updated_at)
+		SELECT j.id, f.url, f.depth, f.state, f.updated_at
+		FROM frontier f
+		JOIN crawl_jobs j ON j.seed = f.seed;
+	DROP TABLE frontier;
+	ALTER TABLE frontier_jobs RENAME TO frontier;
+	CREATE INDEX idx_frontier_state ON frontier (job_id, state);
+	ALTER TABLE pages ADD COLUMN job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL;`,
+	`ALTER TABLE frontier ADD COLUMN source TEXT NOT NULL DEFAULT 'link';
+	ALTER TABLE frontier ADD COLUMN lastmod TEXT NOT NULL DEFAULT '';
+	ALTER TABLE frontier ADD COLUMN priority REAL;
+	ALTER TABLE pages ADD COLUMN source TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE pages ADD COLUMN attempts INTEGER NOT NULL DEFAULT 1;`,
+	`ALTER TABLE pages ADD COLUMN error_category TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN error_message TEXT NOT NULL DEFAULT '';
+	UPDATE pages SET error_category = 'network' WHERE status_code = 0;
+	CREATE INDEX idx_pages_error_category ON pages (error_category);`,
+	`ALTER TABLE pages ADD COLUMN final_url TEXT NOT NULL DEFAULT '';
+	CREATE TABLE redirects (
+		url TEXT NOT NULL,
+		hop INTEGER NOT NULL,
+		job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL,
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		status_code INTEGER NOT NULL,
+		PRIMARY KEY (url, hop)
+	);`,
+	`ALTER TABLE pages ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN content_length INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE pages ADD COLUMN response_time INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE pages ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE pages ADD COLUMN parent_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN headers TEXT NOT NULL DEFAULT '{}';
+	ALTER TABLE frontier ADD COLUMN parent TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source_url TEXT NOT NULL,
+		target_url TEXT NOT NULL,
+		anchor_text TEXT NOT NULL DEFAULT '',
+		rel TEXT NOT NULL DEFAULT '',
+		internal BOOLEAN NOT NULL DEFAULT 0,
+		job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL
+	);
+	CREATE INDEX idx_links_source ON links (source_url);
+	CREATE INDEX idx_links_target ON links (target_url);`,
+	`CREATE TABLE link_checks (
+		url TEXT PRIMARY KEY,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error_category TEXT NOT NULL DEFAULT '',
+		error_message TEXT NOT NULL DEFAULT '',
+		checked_at DATETIME NOT NULL
+	);`,
+	`ALTER TABLE pages ADD COLUMN noindex BOOLEAN NOT NULL DEFAULT 0;
+	ALTER TABLE pages ADD COLUMN nofollow BOOLEAN NOT NULL DEFAULT 0;`,
+	`ALTER TABLE links ADD COLUMN element TEXT NOT NULL DEFAULT 'a';
+	ALTER TABLE links ADD COLUMN kind TEXT NOT NULL DEFAULT 'navigation';`,
+	`ALTER TABLE pages ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN unchanged BOOLEAN NOT NULL DEFAULT 0;`,
+	`CREATE TABLE page_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL,
+		crawled_at DATETIME,
+		status_code INTEGER,
+		error_category TEXT NOT NULL DEFAULT '',
+		error_message TEXT NOT NULL DEFAULT '',
+		final_url TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		content_length INTEGER NOT NULL DEFAULT 0,
+		response_time INTEGER NOT NULL DEFAULT 0,
+		title TEXT NOT NULL DEFAULT '',
+		noindex BOOLEAN NOT NULL DEFAULT 0,
+		unchanged BOOLEAN NOT NULL DEFAULT 0,
+		UNIQUE (url, job_id)
+	);
+	CREATE INDEX idx_page_snapshots_url ON page_snapshots (url, id);
+	INSERT INTO page_snapshots (url, job_id, crawled_at, status_code, error_category,
+		error_message, final_url, content_type, content_length, response_time, title,
+		noindex, unchanged)
+	SELECT url, job_id, crawled_at, status_code, error_category, error_message,
+		final_url, content_type, content_length, response_time, title, noindex, unchanged
+	FROM pages
+	ORDER BY crawled_at;`,
+	`CREATE TABLE schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cron TEXT NOT NULL,
+		seed TEXT NOT NULL,
+		options TEXT NOT NULL DEFAULT '{}',
+		next_run_at DATETIME NOT NULL,
+		last_run_at DATETIME,
+		last_job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL,
+		created_at DATETIME NOT NULL
+	);
+	ALTER TABLE crawl_jobs ADD COLUMN schedule_id INTEGER REFERENCES schedules (id) ON DELETE SET NULL;`,
+	`CREATE TABLE webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL,
+		payload TEXT NOT NULL,
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		last_attempt_at DATETIME
+	);
+	CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id);`,
+	`CREATE TABLE link_check_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error_category TEXT NOT NULL DEFAULT '',
+		error_message TEXT NOT NULL DEFAULT '',
+		checked_at DATETIME NOT NULL,
+		UNIQUE (url, job_id)
+	);
+	CREATE INDEX idx_link_check_snapshots_url ON link_check_snapshots (url, id);`,
+}
+
+func initSchema(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
 
-	_, err := db.Exec(query)
-	return err
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (db *DB) StorePage(page PageData) error {
 	log.Printf("Attempting to store page: %s", page.URL)
 
 	query := `
-	INSERT OR REPLACE INTO pages (url, status_code, crawled_at)
-	VALUES (?, ?, ?)`
+	INSERT OR REPLACE INTO pages (url, status_code, crawled_at, job_id, source, attempts,
+		error_category, error_message, final_url, content_type, content_length, response_time,
+		depth, parent_url, title, description, canonical_url, headers, noindex, nofollow,
+		etag, last_modified, unchanged)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := db.Exec(query, page.URL, page.StatusCode, page.CrawledAt)
+	headers, err := json.Marshal(page.Headers)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, page.URL, page.StatusCode, page.CrawledAt, nullInt64(page.JobID),
+		page.Source, page.Attempts, page.ErrorCategory, page.ErrorMessage, page.FinalURL,
+		page.ContentType, page.ContentLength, page.ResponseTime, page.Depth, page.ParentURL,
+		page.Title, page.Description, page.CanonicalURL, string(headers), page.NoIndex, page.NoFollow,
+		page.ETag, page.LastModified, page.Unchanged)
 	if err != nil {
 		log.Printf("Error storing page: %v", err)
 		return err
 	}
+	if err := db.storeSnapshot(tx, page.URL); err != nil {
+		log.Printf("Error storing snapshot of page: %v", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
 	rowsAffected, _ := result.RowsAffected()
 	log.Printf("Successfully stored page %s. Rows affected: %d", page.URL, rowsAffected)
 	return nil
 }
 
+// GetPage returns the stored page for url, or ErrNotFound.
+func (db *DB) GetPage(url string) (*PageData, error) {
+	rows, err := db.Query(`SELECT `+pageColumns+` FROM pages WHERE url = ?`, url)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := scanPages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, ErrNotFound
+	}
+	return &pages[0], nil
+}
+
+// MarkPageUnchanged records a crawl of page.URL that got a 304 Not Modified
+// response, keeping the stored page. Only the crawl time, job, attempts and
+// response time are updated, along with the validators when the response
+// carries new ones, and the kept page is recorded as the snapshot of the job.
+func (db *DB) MarkPageUnchanged(page PageData) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE pages
+		SET crawled_at = ?, job_id = ?, attempts = ?, response_time = ?, unchanged = 1,
+			etag = COALESCE(NULLIF(?, ''), etag),
+			last_modified = COALESCE(NULLIF(?, ''), last_modified)
+		WHERE url = ?`,
+		page.CrawledAt, nullInt64(page.JobID), page.Attempts, page.ResponseTime,
+		page.ETag, page.LastModified, page.URL)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if err := db.storeSnapshot(tx, page.URL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *DB) GetPages() ([]PageData, error) {
 	log.Printf("Executing GetPages query...")
 
 	query := `
-		SELECT url, status_code, crawled_at
+		SELECT ` + pageColumns + `
 		FROM pages
 		ORDER BY crawled_at DESC
 		LIMIT 100`
@@ -93,17 +433,10 @@ func (db *DB) GetPages() ([]PageData, error) {
 		log.Printf("Error querying pages: %v", err)
 		return nil, err
 	}
-	defer rows.Close()
-
-	var pages []PageData
-	for rows.Next() {
-		var page PageData
-		err := rows.Scan(&page.URL, &page.StatusCode, &page.CrawledAt)
-		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			return nil, err
-		}
-		pages = append(pages, page)
+	pages, err := scanPages(rows)
+	if err != nil {
+		log.Printf("Error scanning row: %v", err)
+		return nil, err
 	}
 
 	log.Printf("Retrieved %d pages from database", len(pages))
@@ -112,7 +445,7 @@ func (db *DB) GetPages() ([]PageData, error) {
 
 func (db *DB) GetPagesByStatus(statusCode int) ([]PageData, error) {
 	query := `
-		SELECT url, status_code, crawled_at
+		SELECT ` + pageColumns + `
 		FROM pages
 		WHERE status_code = ?
 		ORDER BY crawled_at DESC
@@ -122,16 +455,91 @@ func (db *DB) GetPagesByStatus(statusCode int) ([]PageData, error) {
 	if err != nil {
 		return nil, err
 	}
+	return scanPages(rows)
+}
+
+// GetPagesByError returns the pages that failed with the given error
+// category, or with any error if category is empty.
+func (db *DB) GetPagesByError(category string) ([]PageData, error) {
+	query := `
+		SELECT ` + pageColumns + `
+		FROM pages
+		WHERE error_category != '' AND (? = '' OR error_category = ?)
+		ORDER BY crawled_at DESC
+		LIMIT 100`
+
+	rows, err := db.Query(query, category, category)
+	if err != nil {
+		return nil, err
+	}
+	return scanPages(rows)
+}
+
+// Robots directives recorded on pages.
+const (
+	DirectiveNoIndex  = "noindex"
+	DirectiveNoFollow = "nofollow"
+)
+
+// GetPagesByDirective returns the pages carrying the given robots
+// directive, DirectiveNoIndex or DirectiveNoFollow.
+func (db *DB) GetPagesByDirective(directive string) ([]PageData, error) {
+	var column string
+	switch directive {
+	case DirectiveNoIndex:
+		column = "noindex"
+	case DirectiveNoFollow:
+		column = "nofollow"
+	default:
+		return nil, fmt.Errorf("unknown robots directive: %s", directive)
+	}
+
+	query := `
+		SELECT ` + pageColumns + `
+		FROM pages
+		WHERE ` + column + ` = 1
+		ORDER BY crawled_at DESC
+		LIMIT 100`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanPages(rows)
+}
+
+// pageColumns are the pages columns read by scanPages, in order.
+const pageColumns = `url, status_code, crawled_at, COALESCE(job_id, 0), source, attempts,
+	error_category, error_message, final_url, content_type, content_length, response_time,
+	depth, parent_url, title, description, canonical_url, headers, noindex, nofollow,
+	etag, last_modified, unchanged`
+
+// scanPages reads every row of a query selecting pageColumns and closes
+// rows.
+func scanPages(rows *sql.Rows) ([]PageData, error) {
 	defer rows.Close()
 
 	var pages []PageData
 	for rows.Next() {
 		var page PageData
-		err := rows.Scan(&page.URL, &page.StatusCode, &page.CrawledAt)
+		var headers string
+		err := rows.Scan(&page.URL, &page.StatusCode, &page.CrawledAt, &page.JobID, &page.Source,
+			&page.Attempts, &page.ErrorCategory, &page.ErrorMessage, &page.FinalURL,
+			&page.ContentType, &page.ContentLength, &page.ResponseTime, &page.Depth, &page.ParentURL,
+			&page.Title, &page.Description, &page.CanonicalURL, &headers, &page.NoIndex, &page.NoFollow,
+			&page.ETag, &page.LastModified, &page.Unchanged)
 		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal([]byte(headers), &page.Headers); err != nil {
+			return nil, err
+		}
 		pages = append(pages, page)
 	}
-	return pages, nil
+	return pages, rows.Err()
+}
+
+// nullInt64 stores zero IDs as NULL so foreign keys stay valid.
+func nullInt64(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
 }
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -24,6 +26,14 @@ func TestDatabase(t *testing.T) {
 			URL:        "https://example.com/page1",
 			StatusCode: 404,
 			CrawledAt:  time.Now(),
+			NoIndex:    true,
+		},
+		{
+			URL:           "https://example.com/page2",
+			CrawledAt:     time.Now(),
+			Attempts:      3,
+			ErrorCategory: ErrorTimeout,
+			ErrorMessage:  "context deadline exceeded",
 		},
 	}
 
@@ -61,4 +71,390 @@ func TestDatabase(t *testing.T) {
 			t.Errorf("Expected 1 page with status 200, got %d", len(pages))
 		}
 	})
+
+	// Test retrieving pages by error category
+	t.Run("get pages by error", func(t *testing.T) {
+		for _, category := range []string{ErrorTimeout, ""} {
+			pages, err := db.GetPagesByError(category)
+			if err != nil {
+				t.Errorf("GetPagesByError() error = %v", err)
+				return
+			}
+			if len(pages) != 1 || pages[0].ErrorMessage != "context deadline exceeded" || pages[0].Attempts != 3 {
+				t.Errorf("Expected the timed out page for %q, got %+v", category, pages)
+			}
+		}
+
+		pages, err := db.GetPagesByError(ErrorDNS)
+		if err != nil {
+			t.Errorf("GetPagesByError() error = %v", err)
+			return
+		}
+		if len(pages) != 0 {
+			t.Errorf("Expected no page with a DNS error, got %d", len(pages))
+		}
+	})
+
+	// Test retrieving pages by robots directive
+	t.Run("get pages by directive", func(t *testing.T) {
+		pages, err := db.GetPagesByDirective(DirectiveNoIndex)
+		if err != nil {
+			t.Errorf("GetPagesByDirective() error = %v", err)
+			return
+		}
+		if len(pages) != 1 || pages[0].URL != "https://example.com/page1" || !pages[0].NoIndex {
+			t.Errorf("Expected the noindex page, got %+v", pages)
+		}
+
+		pages, err = db.GetPagesByDirective(DirectiveNoFollow)
+		if err != nil {
+			t.Errorf("GetPagesByDirective() error = %v", err)
+			return
+		}
+		if len(pages) != 0 {
+			t.Errorf("Expected no nofollow page, got %d", len(pages))
+		}
+
+		if _, err := db.GetPagesByDirective("noarchive"); err == nil {
+			t.Errorf("Expected an error for an unknown directive")
+		}
+	})
+
+	t.Run("mark page unchanged", func(t *testing.T) {
+		err := db.MarkPageUnchanged(PageData{URL: "https://example.com/page1", CrawledAt: time.Now(), Attempts: 1, ETag: `"v2"`})
+		if err != nil {
+			t.Errorf("MarkPageUnchanged() error = %v", err)
+			return
+		}
+		page, err := db.GetPage("https://example.com/page1")
+		if err != nil {
+			t.Errorf("GetPage() error = %v", err)
+			return
+		}
+		if !page.Unchanged || page.ETag != `"v2"` || page.StatusCode != 404 {
+			t.Errorf("Expected the stored page to be kept and marked unchanged, got %+v", page)
+		}
+
+		if err := db.MarkPageUnchanged(PageData{URL: "https://example.com/missing"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("MarkPageUnchanged() error = %v, want ErrNotFound", err)
+		}
+		if _, err := db.GetPage("https://example.com/missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetPage() error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestFrontier(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	seed := "https://example.com"
+	jobID, err := db.CreateJob(seed, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+
+	for _, u := range []string{seed, seed + "/page1", seed + "/page1"} {
+		if err := db.EnqueueURL(jobID, FrontierEntry{URL: u, Source: SourceLink}); err != nil {
+			t.Fatalf("EnqueueURL() error = %v", err)
+		}
+	}
+	if err := db.SetFrontierState(jobID, seed, FrontierDone); err != nil {
+		t.Fatalf("SetFrontierState() error = %v", err)
+	}
+
+	entries, err := db.GetFrontier(jobID)
+	if err != nil {
+		t.Fatalf("GetFrontier() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 frontier entries, got %d", len(entries))
+	}
+	if entries[0].State != FrontierDone || entries[1].State != FrontierQueued {
+		t.Errorf("Unexpected states: %s, %s", entries[0].State, entries[1].State)
+	}
+
+	if err := db.SkipQueued(jobID); err != nil {
+		t.Fatalf("SkipQueued() error = %v", err)
+	}
+	entries, err = db.GetFrontier(jobID)
+	if err != nil {
+		t.Fatalf("GetFrontier() error = %v", err)
+	}
+	if entries[0].State != FrontierDone || entries[1].State != FrontierSkipped {
+		t.Errorf("Unexpected states after skip: %s, %s", entries[0].State, entries[1].State)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	jobID, err := db.CreateJob("https://example.com", []byte(`{"max_pages":10}`))
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+
+	unfinished, err := db.UnfinishedJobs()
+	if err != nil {
+		t.Fatalf("UnfinishedJobs() error = %v", err)
+	}
+	if len(unfinished) != 1 || unfinished[0].ID != jobID {
+		t.Errorf("Expected job %d to be unfinished, got %v", jobID, unfinished)
+	}
+	if job, err := db.UnfinishedJob("https://example.com"); err != nil || job.ID != jobID {
+		t.Errorf("Expected job %d to be the unfinished job of its seed, got %v, %v", jobID, job, err)
+	}
+	if _, err := db.UnfinishedJob("https://example.org"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for another seed, got %v", err)
+	}
+
+	if err := db.StartJob(jobID); err != nil {
+		t.Fatalf("StartJob() error = %v", err)
+	}
+	if err := db.StorePage(PageData{URL: "https://example.com", StatusCode: 200, CrawledAt: time.Now(), JobID: jobID}); err != nil {
+		t.Fatalf("StorePage() error = %v", err)
+	}
+	for _, failed := range []bool{false, true} {
+		if err := db.IncrementJobPages(jobID, failed); err != nil {
+			t.Fatalf("IncrementJobPages() error = %v", err)
+		}
+	}
+	if err := db.FinishJob(jobID, JobCompleted, "max_pages", ""); err != nil {
+		t.Fatalf("FinishJob() error = %v", err)
+	}
+
+	if _, err := db.UnfinishedJob("https://example.com"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound once the job completed, got %v", err)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if job.State != JobCompleted || job.StopReason != "max_pages" {
+		t.Errorf("Unexpected state %s and stop reason %s", job.State, job.StopReason)
+	}
+	if job.PagesCrawled != 2 || job.PagesFailed != 1 {
+		t.Errorf("Expected 2 pages crawled and 1 failed, got %d and %d", job.PagesCrawled, job.PagesFailed)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		t.Errorf("Expected start and finish times to be set")
+	}
+	if string(job.Options) != `{"max_pages":10}` {
+		t.Errorf("Unexpected options %s", job.Options)
+	}
+
+	pages, err := db.GetPages()
+	if err != nil {
+		t.Fatalf("GetPages() error = %v", err)
+	}
+	if len(pages) != 1 || pages[0].JobID != jobID {
+		t.Errorf("Expected page linked to job %d, got %v", jobID, pages)
+	}
+
+	if _, err := db.GetJob(jobID + 1); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown job, got %v", err)
+	}
+}
+
+func TestPageHistory(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	db.SetHistoryRetention(3)
+
+	const url = "https://example.com/page"
+	statuses := []int{200, 200, 200, 404}
+	for _, status := range statuses {
+		jobID, err := db.CreateJob("https://example.com", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+		if err := db.StorePage(PageData{URL: url, StatusCode: status, CrawledAt: time.Now(), JobID: jobID}); err != nil {
+			t.Fatalf("StorePage() error = %v", err)
+		}
+		// Storing the page again in the same job replaces its snapshot
+		if err := db.StorePage(PageData{URL: url, StatusCode: status, CrawledAt: time.Now(), JobID: jobID}); err != nil {
+			t.Fatalf("StorePage() error = %v", err)
+		}
+	}
+	if err := db.MarkPageUnchanged(PageData{URL: url, CrawledAt: time.Now()}); err != nil {
+		t.Fatalf("MarkPageUnchanged() error = %v", err)
+	}
+
+	history, err := db.GetPageHistory(url)
+	if err != nil {
+		t.Fatalf("GetPageHistory() error = %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected the 3 latest snapshots to be kept, got %+v", history)
+	}
+	for i, want := range []int{200, 404, 404} {
+		if history[i].StatusCode != want {
+			t.Errorf("Snapshot %d status = %d, want %d", i, history[i].StatusCode, want)
+		}
+	}
+	if history[0].JobID != 3 || history[1].JobID != 4 {
+		t.Errorf("Expected the snapshots of jobs 3 and 4 first, got %+v", history)
+	}
+	if last := history[2]; !last.Unchanged {
+		t.Errorf("Expected the last snapshot to be unchanged, got %+v", last)
+	}
+
+	history, err = db.GetPageHistory("https://example.com/missing")
+	if err != nil || len(history) != 0 {
+		t.Errorf("GetPageHistory() = %v, %v, want no snapshots", history, err)
+	}
+}
+
+func TestDiffCrawls(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	crawl := func(pages ...PageData) int64 {
+		jobID, err := db.CreateJob("https://example.com", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+		for _, page := range pages {
+			page.JobID, page.CrawledAt = jobID, time.Now()
+			if err := db.StorePage(page); err != nil {
+				t.Fatalf("StorePage() error = %v", err)
+			}
+		}
+		return jobID
+	}
+	from := crawl(
+		PageData{URL: "https://example.com/", StatusCode: 200, Title: "Home", FinalURL: "https://example.com/"},
+		PageData{URL: "https://example.com/old", StatusCode: 200},
+		PageData{URL: "https://example.com/moved", StatusCode: 200, FinalURL: "https://example.com/v1"},
+		PageData{URL: "https://example.com/gone", StatusCode: 200},
+		PageData{URL: "https://example.com/blocked", ErrorCategory: ErrorRobotsBlocked},
+	)
+	to := crawl(
+		PageData{URL: "https://example.com/", StatusCode: 200, Title: "Welcome", FinalURL: "https://example.com/"},
+		PageData{URL: "https://example.com/moved", StatusCode: 200, FinalURL: "https://example.com/v2"},
+		PageData{URL: "https://example.com/gone", StatusCode: 404},
+		PageData{URL: "https://example.com/blocked", ErrorCategory: ErrorRobotsBlocked},
+		PageData{URL: "https://example.com/new", ErrorCategory: ErrorTimeout},
+	)
+
+	// External links checked by each job
+	checks := map[int64][]LinkCheck{
+		from: {
+			{URL: "https://partner.example/ok", StatusCode: 200},
+			{URL: "https://partner.example/down", StatusCode: 200},
+			{URL: "https://partner.example/dead", StatusCode: 404},
+		},
+		to: {
+			{URL: "https://partner.example/ok", StatusCode: 200},
+			{URL: "https://partner.example/down", StatusCode: 503},
+			{URL: "https://partner.example/dead", StatusCode: 404},
+			{URL: "https://partner.example/logo.png", ErrorCategory: ErrorDNS},
+		},
+	}
+	for jobID, jobChecks := range checks {
+		for _, check := range jobChecks {
+			check.JobID, check.CheckedAt = jobID, time.Now()
+			if err := db.StoreLinkCheck(check); err != nil {
+				t.Fatalf("StoreLinkCheck() error = %v", err)
+			}
+		}
+	}
+
+	diff, err := db.DiffCrawls(from, to)
+	if err != nil {
+		t.Fatalf("DiffCrawls() error = %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].URL != "https://example.com/new" {
+		t.Errorf("Added = %+v, want /new", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].URL != "https://example.com/old" {
+		t.Errorf("Removed = %+v, want /old", diff.Removed)
+	}
+	wantChanges := map[string][]PageChange{
+		"status":   {{URL: "https://example.com/gone", From: "200", To: "404"}},
+		"redirect": {{URL: "https://example.com/moved", From: "https://example.com/v1", To: "https://example.com/v2"}},
+		"title":    {{URL: "https://example.com/", From: "Home", To: "Welcome"}},
+		"broken": {
+			{URL: "https://example.com/gone", From: "200", To: "404"},
+			{URL: "https://example.com/new", To: ErrorTimeout},
+			{URL: "https://partner.example/down", From: "200", To: "503"},
+			{URL: "https://partner.example/logo.png", To: ErrorDNS},
+		},
+	}
+	gotChanges := map[string][]PageChange{
+		"status":   diff.StatusChanged,
+		"redirect": diff.RedirectChanged,
+		"title":    diff.TitleChanged,
+		"broken":   diff.NewBroken,
+	}
+	for name, want := range wantChanges {
+		if fmt.Sprint(gotChanges[name]) != fmt.Sprint(want) {
+			t.Errorf("%s changes = %+v, want %+v", name, gotChanges[name], want)
+		}
+	}
+
+	if _, err := db.DiffCrawls(from, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DiffCrawls() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBrokenLinksLimit(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	jobID, err := db.CreateJob("https://example.com", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+
+	// More broken pages than GetBrokenLinks returns, each linked from the
+	// home page
+	const n = 1200
+	var links []Link
+	for i := 0; i < n; i++ {
+		u := fmt.Sprintf("https://example.com/missing%04d", i)
+		if err := db.StorePage(PageData{URL: u, StatusCode: 404, CrawledAt: time.Now(), JobID: jobID}); err != nil {
+			t.Fatalf("StorePage() error = %v", err)
+		}
+		links = append(links, Link{TargetURL: u, Internal: true})
+	}
+	if err := db.StoreLinks("https://example.com", jobID, links); err != nil {
+		t.Fatalf("StoreLinks() error = %v", err)
+	}
+
+	broken, err := db.GetBrokenLinks(jobID)
+	if err != nil {
+		t.Fatalf("GetBrokenLinks() error = %v", err)
+	}
+	if len(broken) != 1000 {
+		t.Errorf("Expected GetBrokenLinks to stop at 1000, got %d", len(broken))
+	}
+
+	broken, err = db.GetAllBrokenLinks(jobID)
+	if err != nil {
+		t.Fatalf("GetAllBrokenLinks() error = %v", err)
+	}
+	if len(broken) != n {
+		t.Fatalf("Expected %d broken links, got %d", n, len(broken))
+	}
+	if last := broken[n-1]; last.URL != "https://example.com/missing1199" || len(last.Sources) != 1 {
+		t.Errorf("Expected the last broken page with its source, got %+v", last)
+	}
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+)
+
+// CrawlDiff lists what changed between the pages of two crawl jobs, as
+// recorded in their page snapshots. Each list is sorted by URL.
+type CrawlDiff struct {
+	From int64
+	To   int64
+	// Added and Removed are the pages crawled by only one of the jobs.
+	Added   []PageSnapshot
+	Removed []PageSnapshot
+	// StatusChanged, RedirectChanged and TitleChanged are the pages crawled
+	// by both jobs whose status, final URL or title differ.
+	StatusChanged   []PageChange
+	RedirectChanged []PageChange
+	TitleChanged    []PageChange
+	// NewBroken are the pages and checked links, such as external links and
+	// assets, broken in the To job that were missing or working in the From
+	// job.
+	NewBroken []PageChange
+}
+
+// PageChange is a value of a page that differs between two crawls. From is
+// empty for pages the first crawl did not reach.
+type PageChange struct {
+	URL  string
+	From string
+	To   string
+}
+
+// Broken reports whether the page answered with a non-2xx status or failed,
+// like the pages listed by GetBrokenLinks.
+func (s PageSnapshot) Broken() bool {
+	if s.ErrorCategory == ErrorRobotsBlocked {
+		return false
+	}
+	return s.StatusCode < 200 || s.StatusCode > 299 || s.ErrorCategory != ""
+}
+
+// Status returns the error category of the page, or its status code when it
+// was fetched.
+func (s PageSnapshot) Status() string {
+	if s.ErrorCategory != "" {
+		return s.ErrorCategory
+	}
+	return strconv.Itoa(s.StatusCode)
+}
+
+// DiffCrawls compares the pages crawled by two jobs, or returns ErrNotFound
+// if either job does not exist. Pages whose snapshots were deleted past the
+// history retention are compared as if they were not crawled.
+func (db *DB) DiffCrawls(from, to int64) (*CrawlDiff, error) {
+	before, err := db.getJobSnapshots(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := db.getJobSnapshots(to)
+	if err != nil {
+		return nil, err
+	}
+	checkedBefore, err := db.getJobLinkChecks(from)
+	if err != nil {
+		return nil, err
+	}
+	checkedAfter, err := db.getJobLinkChecks(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &CrawlDiff{
+		From:            from,
+		To:              to,
+		Added:           []PageSnapshot{},
+		Removed:         []PageSnapshot{},
+		StatusChanged:   []PageChange{},
+		RedirectChanged: []PageChange{},
+		TitleChanged:    []PageChange{},
+		NewBroken:       []PageChange{},
+	}
+	for _, url := range sortedURLs(before, after) {
+		old, inBefore := before[url]
+		cur, inAfter := after[url]
+		switch {
+		case !inAfter:
+			diff.Removed = append(diff.Removed, old)
+			continue
+		case !inBefore:
+			diff.Added = append(diff.Added, cur)
+			if cur.Broken() {
+				diff.NewBroken = append(diff.NewBroken, PageChange{URL: url, To: cur.Status()})
+			}
+			continue
+		}
+
+		if old.Status() != cur.Status() {
+			diff.StatusChanged = append(diff.StatusChanged, PageChange{URL: url, From: old.Status(), To: cur.Status()})
+		}
+		if old.FinalURL != cur.FinalURL && old.FinalURL != "" && cur.FinalURL != "" {
+			diff.RedirectChanged = append(diff.RedirectChanged, PageChange{URL: url, From: old.FinalURL, To: cur.FinalURL})
+		}
+		if old.Title != cur.Title {
+			diff.TitleChanged = append(diff.TitleChanged, PageChange{URL: url, From: old.Title, To: cur.Title})
+		}
+		if cur.Broken() && !old.Broken() {
+			diff.NewBroken = append(diff.NewBroken, PageChange{URL: url, From: old.Status(), To: cur.Status()})
+		}
+	}
+
+	newBroken := len(diff.NewBroken)
+	for url, cur := range checkedAfter {
+		if _, crawled := after[url]; crawled || !cur.Broken() {
+			continue
+		}
+		change := PageChange{URL: url, To: cur.Status()}
+		if old, ok := before[url]; ok {
+			if old.Broken() {
+				continue
+			}
+			change.From = old.Status()
+		} else if old, ok := checkedBefore[url]; ok {
+			if old.Broken() {
+				continue
+			}
+			change.From = old.Status()
+		}
+		diff.NewBroken = append(diff.NewBroken, change)
+	}
+	if len(diff.NewBroken) > newBroken {
+		sort.Slice(diff.NewBroken, func(i, j int) bool {
+			return diff.NewBroken[i].URL < diff.NewBroken[j].URL
+		})
+	}
+	return diff, nil
+}
+
+// getJobSnapshots returns the page snapshots of a job by URL.
+func (db *DB) getJobSnapshots(jobID int64) (map[string]PageSnapshot, error) {
+	if _, err := db.GetJob(jobID); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+snapshotColumns+` FROM page_snapshots WHERE job_id = ?`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make(map[string]PageSnapshot)
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[s.URL] = s
+	}
+	return snapshots, rows.Err()
+}
+
+// getJobLinkChecks returns the link checks made for a job by URL.
+func (db *DB) getJobLinkChecks(jobID int64) (map[string]LinkCheck, error) {
+	rows, err := db.Query(`
+		SELECT url, status_code, error_category, error_message, checked_at
+		FROM link_check_snapshots
+		WHERE job_id = ?`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := make(map[string]LinkCheck)
+	for rows.Next() {
+		c := LinkCheck{JobID: jobID}
+		if err := rows.Scan(&c.URL, &c.StatusCode, &c.ErrorCategory, &c.ErrorMessage, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks[c.URL] = c
+	}
+	return checks, rows.Err()
+}
+
+// sortedURLs returns the URLs of both snapshot sets, sorted.
+func sortedURLs(a, b map[string]PageSnapshot) []string {
+	urls := make([]string, 0, len(a)+len(b))
+	for url := range a {
+		urls = append(urls, url)
+	}
+	for url := range b {
+		if _, ok := a[url]; !ok {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
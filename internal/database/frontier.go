@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Frontier states of a discovered URL.
+const (
+	FrontierQueued   = "queued"
+	FrontierInFlight = "in_flight"
+	FrontierDone     = "done"
+	FrontierFailed   = "failed"
+	// FrontierSkipped marks URLs left unfetched because the crawl stopped
+	// on one of its limits.
+	FrontierSkipped = "skipped"
+	// FrontierOutOfScope marks links discovered outside the crawl's scope
+	// rules, which are never fetched.
+	FrontierOutOfScope = "out_of_scope"
+	// FrontierBlocked marks links disallowed by robots.txt.
+	FrontierBlocked = "blocked"
+)
+
+// How a URL was discovered.
+const (
+	SourceSeed    = "seed"
+	SourceLink    = "link"
+	SourceSitemap = "sitemap"
+)
+
+type FrontierEntry struct {
+	URL    string
+	Depth  int
+	State  string
+	Source string
+	// LastMod and Priority are copied from the sitemap listing the URL.
+	LastMod  string
+	Priority *float64
+	// Parent is the page the URL was first found on.
+	Parent    string
+	UpdatedAt time.Time
+}
+
+// EnqueueURL records entry for the given crawl job, as queued unless it has
+// a state. It is a no-op if the URL is already part of the job's frontier.
+func (db *DB) EnqueueURL(jobID int64, entry FrontierEntry) error {
+	query := `
+	INSERT OR IGNORE INTO frontier (job_id, url, depth, state, source, lastmod, priority, parent, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var priority sql.NullFloat64
+	if entry.Priority != nil {
+		priority = sql.NullFloat64{Float64: *entry.Priority, Valid: true}
+	}
+	state := entry.State
+	if state == "" {
+		state = FrontierQueued
+	}
+	_, err := db.Exec(query, jobID, entry.URL, entry.Depth, state,
+		entry.Source, entry.LastMod, priority, entry.Parent, time.Now())
+	return err
+}
+
+// SetFrontierState updates the state of url in the given crawl job.
+func (db *DB) SetFrontierState(jobID int64, url, state string) error {
+	query := `
+	UPDATE frontier SET state = ?, updated_at = ?
+	WHERE job_id = ? AND url = ?`
+
+	_, err := db.Exec(query, state, time.Now(), jobID, url)
+	return err
+}
+
+// GetFrontier returns every URL discovered by the given crawl job.
+func (db *DB) GetFrontier(jobID int64) ([]FrontierEntry, error) {
+	query := `
+		SELECT url, depth, state, source, lastmod, priority, parent, updated_at
+		FROM frontier
+		WHERE job_id = ?
+		ORDER BY rowid`
+
+	rows, err := db.Query(query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []FrontierEntry
+	for rows.Next() {
+		var entry FrontierEntry
+		var priority sql.NullFloat64
+		err := rows.Scan(&entry.URL, &entry.Depth, &entry.State, &entry.Source,
+			&entry.LastMod, &priority, &entry.Parent, &entry.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if priority.Valid {
+			entry.Priority = &priority.Float64
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SkipQueued marks every URL still queued or in flight in the given crawl
+// job as skipped.
+func (db *DB) SkipQueued(jobID int64) error {
+	query := `
+	UPDATE frontier SET state = ?, updated_at = ?
+	WHERE job_id = ? AND state IN (?, ?)`
+
+	_, err := db.Exec(query, FrontierSkipped, time.Now(), jobID, FrontierQueued, FrontierInFlight)
+	return err
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DefaultHistoryRetention is the number of snapshots kept per URL when none
+// is configured.
+const DefaultHistoryRetention = 10
+
+// PageSnapshot is the state of a page as recorded by one crawl. Storing a
+// page records a snapshot, so the history of a URL survives the pages row
+// being replaced by later crawls.
+type PageSnapshot struct {
+	URL           string
+	JobID         int64
+	CrawledAt     time.Time
+	StatusCode    int
+	ErrorCategory string
+	ErrorMessage  string
+	FinalURL      string
+	ContentType   string
+	ContentLength int64
+	ResponseTime  time.Duration
+	Title         string
+	NoIndex       bool
+	// Unchanged is set when the crawl got a 304 Not Modified response.
+	Unchanged bool
+}
+
+// snapshotColumns are the columns copied from pages into page_snapshots.
+const snapshotColumns = `url, COALESCE(job_id, 0), crawled_at, COALESCE(status_code, 0),
+	error_category, error_message, final_url, content_type, content_length,
+	response_time, title, noindex, unchanged`
+
+// SetHistoryRetention sets the number of snapshots kept per URL, the oldest
+// being deleted past it. Zero keeps every snapshot.
+func (db *DB) SetHistoryRetention(n int) {
+	db.historyRetention = n
+}
+
+// storeSnapshot records the stored page of url as the snapshot of its job,
+// replacing an earlier snapshot of the same job, and deletes the snapshots
+// past the retention.
+func (db *DB) storeSnapshot(tx *sql.Tx, url string) error {
+	_, err := tx.Exec(`
+		INSERT OR REPLACE INTO page_snapshots (url, job_id, crawled_at, status_code,
+			error_category, error_message, final_url, content_type, content_length,
+			response_time, title, noindex, unchanged)
+		SELECT url, job_id, crawled_at, status_code, error_category, error_message,
+			final_url, content_type, content_length, response_time, title, noindex, unchanged
+		FROM pages
+		WHERE url = ?`, url)
+	if err != nil || db.historyRetention <= 0 {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM page_snapshots
+		WHERE url = ? AND id NOT IN (
+			SELECT id FROM page_snapshots WHERE url = ? ORDER BY id DESC LIMIT ?
+		)`, url, url, db.historyRetention)
+	return err
+}
+
+// storeLinkCheckSnapshot records check as the snapshot of its link for its
+// job, replacing an earlier one, and deletes the snapshots past the
+// retention.
+func (db *DB) storeLinkCheckSnapshot(tx *sql.Tx, check LinkCheck) error {
+	_, err := tx.Exec(`
+		INSERT OR REPLACE INTO link_check_snapshots (url, job_id, status_code,
+			error_category, error_message, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		check.URL, check.JobID, check.StatusCode, check.ErrorCategory, check.ErrorMessage, check.CheckedAt)
+	if err != nil || db.historyRetention <= 0 {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM link_check_snapshots
+		WHERE url = ? AND id NOT IN (
+			SELECT id FROM link_check_snapshots WHERE url = ? ORDER BY id DESC LIMIT ?
+		)`, check.URL, check.URL, db.historyRetention)
+	return err
+}
+
+// GetPageHistory returns the snapshots of url, oldest first.
+func (db *DB) GetPageHistory(url string) ([]PageSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT `+snapshotColumns+`
+		FROM page_snapshots
+		WHERE url = ?
+		ORDER BY id`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PageSnapshot{}
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, s)
+	}
+	return history, rows.Err()
+}
+
+func scanSnapshot(rows *sql.Rows) (PageSnapshot, error) {
+	var s PageSnapshot
+	err := rows.Scan(&s.URL, &s.JobID, &s.CrawledAt, &s.StatusCode,
+		&s.ErrorCategory, &s.ErrorMessage, &s.FinalURL, &s.ContentType, &s.ContentLength,
+		&s.ResponseTime, &s.Title, &s.NoIndex, &s.Unchanged)
+	return s, err
+}
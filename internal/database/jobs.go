@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Crawl job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobPaused    = "paused"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+type CrawlJob struct {
+	ID           int64
+	Seed         string
+	Options      json.RawMessage
+	State        string
+	PagesCrawled int
+	PagesFailed  int
+	StopReason   string
+	Error        string
+	// ScheduleID is the schedule that started the job, or 0.
+	ScheduleID int64
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+const jobColumns = `id, seed, options, state, pages_crawled, pages_failed,
+	stop_reason, error, COALESCE(schedule_id, 0), created_at, started_at, finished_at`
+
+// CreateJob records a new queued crawl job and returns its ID.
+func (db *DB) CreateJob(seed string, options json.RawMessage) (int64, error) {
+	query := `
+	INSERT INTO crawl_jobs (seed, options, state, created_at)
+	VALUES (?, ?, ?, ?)`
+
+	result, err := db.Exec(query, seed, string(options), JobQueued, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// StartJob marks a job as running. A resumed job keeps its original start
+// time.
+func (db *DB) StartJob(id int64) error {
+	query := `
+	UPDATE crawl_jobs SET state = ?, started_at = COALESCE(started_at, ?)
+	WHERE id = ?`
+
+	_, err := db.Exec(query, JobRunning, time.Now(), id)
+	return err
+}
+
+// FinishJob records the final state of a job along with why it stopped and
+// the error that ended it, if any.
+func (db *DB) FinishJob(id int64, state, stopReason, errMsg string) error {
+	query := `
+	UPDATE crawl_jobs SET state = ?, stop_reason = ?, error = ?, finished_at = ?
+	WHERE id = ?`
+
+	_, err := db.Exec(query, state, stopReason, errMsg, time.Now(), id)
+	return err
+}
+
+// PauseJob marks a job as paused. Its frontier is left untouched so the job
+// can be resumed.
+func (db *DB) PauseJob(id int64) error {
+	_, err := db.Exec("UPDATE crawl_jobs SET state = ? WHERE id = ?", JobPaused, id)
+	return err
+}
+
+// RequeueJob marks an interrupted job as queued so it is resumed on the
+// next start.
+func (db *DB) RequeueJob(id int64) error {
+	_, err := db.Exec("UPDATE crawl_jobs SET state = ? WHERE id = ?", JobQueued, id)
+	return err
+}
+
+// IncrementJobPages counts a processed page against a job.
+func (db *DB) IncrementJobPages(id int64, failed bool) error {
+	query := `
+	UPDATE crawl_jobs
+	SET pages_crawled = pages_crawled + 1,
+		pages_failed = pages_failed + ?
+	WHERE id = ?`
+
+	var inc int
+	if failed {
+		inc = 1
+	}
+	_, err := db.Exec(query, inc, id)
+	return err
+}
+
+// GetJob returns the job with the given ID, or ErrNotFound.
+func (db *DB) GetJob(id int64) (*CrawlJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM crawl_jobs WHERE id = ?`
+
+	job, err := scanJob(db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// GetJobs returns the most recent jobs, newest first.
+func (db *DB) GetJobs() ([]CrawlJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM crawl_jobs
+		ORDER BY id DESC
+		LIMIT 100`
+
+	return db.queryJobs(query)
+}
+
+// UnfinishedJobs returns the jobs that were queued or running, typically
+// because the process stopped mid-crawl, oldest first.
+func (db *DB) UnfinishedJobs() ([]CrawlJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM crawl_jobs
+		WHERE state IN (?, ?)
+		ORDER BY id`
+
+	return db.queryJobs(query, JobQueued, JobRunning)
+}
+
+// UnfinishedJob returns the last job of seed that was queued or running, or
+// ErrNotFound.
+func (db *DB) UnfinishedJob(seed string) (*CrawlJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM crawl_jobs
+		WHERE seed = ? AND state IN (?, ?)
+		ORDER BY id DESC
+		LIMIT 1`
+
+	job, err := scanJob(db.QueryRow(query, seed, JobQueued, JobRunning))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// PreviousJob returns the last job of the same seed that completed before
+// job, or ErrNotFound.
+func (db *DB) PreviousJob(job CrawlJob) (*CrawlJob, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM crawl_jobs
+		WHERE seed = ? AND id < ? AND state = ?
+		ORDER BY id DESC
+		LIMIT 1`
+
+	prev, err := scanJob(db.QueryRow(query, job.Seed, job.ID, JobCompleted))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return prev, err
+}
+
+func (db *DB) queryJobs(query string, args ...interface{}) ([]CrawlJob, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []CrawlJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*CrawlJob, error) {
+	var job CrawlJob
+	var options string
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Seed, &options, &job.State, &job.PagesCrawled, &job.PagesFailed,
+		&job.StopReason, &job.Error, &job.ScheduleID, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Options = json.RawMessage(options)
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
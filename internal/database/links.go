@@ -0,0 +1,94 @@
+package database
+
+import "fmt"
+
+// Link is an edge of the link graph: a hyperlink from a crawled page to a
+// target URL.
+type Link struct {
+	SourceURL  string
+	TargetURL  string
+	AnchorText string
+	Rel        string
+	// Element is the HTML element the link was found on, and Kind what it
+	// is used for, such as "navigation" or "asset".
+	Element string
+	Kind    string
+	// Internal is set when the target is on one of the crawled hosts.
+	Internal bool
+	JobID    int64
+}
+
+// StoreLinks replaces the outgoing links recorded for sourceURL.
+func (db *DB) StoreLinks(sourceURL string, jobID int64, links []Link) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM links WHERE source_url = ?", sourceURL); err != nil {
+		return err
+	}
+	for _, link := range links {
+		_, err := tx.Exec(`
+		INSERT INTO links (source_url, target_url, anchor_text, rel, element, kind, internal, job_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			sourceURL, link.TargetURL, link.AnchorText, link.Rel, link.Element, link.Kind,
+			link.Internal, nullInt64(jobID))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReuseLinks assigns the outgoing links recorded for sourceURL to jobID and
+// returns all of them, for pages found unchanged by a new crawl.
+func (db *DB) ReuseLinks(sourceURL string, jobID int64) ([]Link, error) {
+	_, err := db.Exec("UPDATE links SET job_id = ? WHERE source_url = ?", nullInt64(jobID), sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	return db.queryLinks("WHERE source_url = ?", 0, sourceURL)
+}
+
+// GetInlinks returns the links pointing to url.
+func (db *DB) GetInlinks(url string) ([]Link, error) {
+	return db.queryLinks("WHERE target_url = ?", 1000, url)
+}
+
+// GetOutlinks returns the links found on the page at url.
+func (db *DB) GetOutlinks(url string) ([]Link, error) {
+	return db.queryLinks("WHERE source_url = ?", 1000, url)
+}
+
+// queryLinks returns the links matching where, up to limit unless it is
+// zero.
+func (db *DB) queryLinks(where string, limit int, args ...interface{}) ([]Link, error) {
+	query := `
+		SELECT source_url, target_url, anchor_text, rel, element, kind, internal, COALESCE(job_id, 0)
+		FROM links
+		` + where + `
+		ORDER BY id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var link Link
+		err := rows.Scan(&link.SourceURL, &link.TargetURL, &link.AnchorText, &link.Rel,
+			&link.Element, &link.Kind, &link.Internal, &link.JobID)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,83 @@
+package database
+
+// RedirectHop is one redirect followed while fetching a page.
+type RedirectHop struct {
+	Source     string
+	Target     string
+	StatusCode int
+}
+
+// RedirectChain is the sequence of redirects followed from a page URL.
+type RedirectChain struct {
+	URL      string
+	FinalURL string
+	JobID    int64
+	Hops     []RedirectHop
+	// Loop is set when the chain came back to a URL it had already visited.
+	Loop bool
+}
+
+// StoreRedirects replaces the redirect hops recorded for url.
+func (db *DB) StoreRedirects(url string, jobID int64, hops []RedirectHop) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM redirects WHERE url = ?", url); err != nil {
+		return err
+	}
+	for i, hop := range hops {
+		_, err := tx.Exec(`
+		INSERT INTO redirects (url, hop, job_id, source, target, status_code)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+			url, i, nullInt64(jobID), hop.Source, hop.Target, hop.StatusCode)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRedirectChains returns the redirect chains with more than minHops hops,
+// along with every redirect loop. With loopsOnly, only loops are returned.
+func (db *DB) GetRedirectChains(minHops int, loopsOnly bool) ([]RedirectChain, error) {
+	query := `
+		SELECT p.url, p.final_url, COALESCE(p.job_id, 0), p.error_category = ?,
+			r.source, r.target, r.status_code
+		FROM pages p
+		JOIN redirects r ON r.url = p.url
+		WHERE p.url IN (
+			SELECT url FROM redirects GROUP BY url HAVING COUNT(*) > ?
+			UNION
+			SELECT url FROM pages WHERE error_category = ?
+		)
+		AND (? = 0 OR p.error_category = ?)
+		ORDER BY p.url, r.hop
+		LIMIT 1000`
+
+	rows, err := db.Query(query, ErrorRedirectLoop, minHops, ErrorRedirectLoop, loopsOnly, ErrorRedirectLoop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chains []RedirectChain
+	for rows.Next() {
+		var chain RedirectChain
+		var hop RedirectHop
+		err := rows.Scan(&chain.URL, &chain.FinalURL, &chain.JobID, &chain.Loop,
+			&hop.Source, &hop.Target, &hop.StatusCode)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(chains); n > 0 && chains[n-1].URL == chain.URL {
+			chains[n-1].Hops = append(chains[n-1].Hops, hop)
+			continue
+		}
+		chain.Hops = []RedirectHop{hop}
+		chains = append(chains, chain)
+	}
+	return chains, rows.Err()
+}
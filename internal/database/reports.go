@@ -0,0 +1,177 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LinkCheck is the outcome of checking a link target that was not crawled,
+// such as a link to another site.
+type LinkCheck struct {
+	URL           string
+	StatusCode    int
+	ErrorCategory string
+	ErrorMessage  string
+	CheckedAt     time.Time
+	// JobID is the job whose links were checked, if any. The outcome is then
+	// also kept as the snapshot of the link for that job.
+	JobID int64
+}
+
+// BrokenLink is a link target that answered with a non-2xx status or could
+// not be fetched, along with the links pointing to it.
+type BrokenLink struct {
+	URL           string
+	StatusCode    int
+	ErrorCategory string
+	ErrorMessage  string
+	// Checked is set for targets that were not crawled, such as external
+	// links and assets, but checked with a HEAD request.
+	Checked bool
+	Sources []Link
+}
+
+// StoreLinkCheck records the outcome of a link check, replacing the previous
+// one for the same URL, and the snapshot of the link for check.JobID.
+func (db *DB) StoreLinkCheck(check LinkCheck) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT OR REPLACE INTO link_checks (url, status_code, error_category, error_message, checked_at)
+	VALUES (?, ?, ?, ?, ?)`,
+		check.URL, check.StatusCode, check.ErrorCategory, check.ErrorMessage, check.CheckedAt)
+	if err != nil {
+		return err
+	}
+	if check.JobID != 0 {
+		if err := db.storeLinkCheckSnapshot(tx, check); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Broken reports whether the link answered with a non-2xx status or failed.
+func (c LinkCheck) Broken() bool {
+	return c.StatusCode < 200 || c.StatusCode > 299 || c.ErrorCategory != ""
+}
+
+// Status returns the error category of the link, or its status code when it
+// answered.
+func (c LinkCheck) Status() string {
+	if c.ErrorCategory != "" {
+		return c.ErrorCategory
+	}
+	return strconv.Itoa(c.StatusCode)
+}
+
+// GetUncrawledExternalLinks returns the external link targets that were not
+// crawled. A zero jobID returns the targets of every job.
+func (db *DB) GetUncrawledExternalLinks(jobID int64) ([]string, error) {
+	return db.queryUncrawledLinks("internal = 0", jobID)
+}
+
+// GetUncrawledAssets returns the targets of the asset links to the crawled
+// hosts, such as images and scripts, that were not crawled. A zero jobID
+// returns the targets of every job.
+func (db *DB) GetUncrawledAssets(jobID int64) ([]string, error) {
+	return db.queryUncrawledLinks("internal = 1 AND kind = 'asset'", jobID)
+}
+
+func (db *DB) queryUncrawledLinks(where string, jobID int64) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT target_url
+		FROM links
+		WHERE `+where+`
+		AND (? = 0 OR job_id = ?)
+		AND target_url NOT IN (SELECT url FROM pages)
+		ORDER BY target_url`, jobID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// GetBrokenLinks returns the crawled pages and checked links that answered
+// with a non-2xx status or failed, with the links pointing to them. Pages
+// blocked by robots.txt were never requested and are left out. A non-zero
+// jobID restricts the report to the pages and links of that job. At most
+// 1000 links are returned; see GetAllBrokenLinks.
+func (db *DB) GetBrokenLinks(jobID int64) ([]BrokenLink, error) {
+	return db.queryBrokenLinks(jobID, 1000)
+}
+
+// GetAllBrokenLinks is GetBrokenLinks without a limit, for callers that
+// must see every broken link, such as the CI check.
+func (db *DB) GetAllBrokenLinks(jobID int64) ([]BrokenLink, error) {
+	return db.queryBrokenLinks(jobID, 0)
+}
+
+// queryBrokenLinks returns the broken links, up to limit links pointing to
+// them unless it is zero.
+func (db *DB) queryBrokenLinks(jobID int64, limit int) ([]BrokenLink, error) {
+	query := `
+		SELECT t.url, t.status_code, t.error_category, t.error_message, t.checked,
+			COALESCE(l.source_url, ''), COALESCE(l.anchor_text, ''), COALESCE(l.rel, ''),
+			COALESCE(l.element, ''), COALESCE(l.kind, ''), COALESCE(l.internal, 0), COALESCE(l.job_id, 0)
+		FROM (
+			SELECT url, status_code, error_category, error_message, 0 AS checked, job_id
+			FROM pages
+			WHERE (status_code NOT BETWEEN 200 AND 299 OR error_category != '')
+			AND error_category != ?
+			UNION ALL
+			SELECT url, status_code, error_category, error_message, 1, NULL
+			FROM link_checks
+			WHERE (status_code NOT BETWEEN 200 AND 299 OR error_category != '')
+			AND url NOT IN (SELECT url FROM pages)
+			AND url IN (SELECT target_url FROM links)
+		) t
+		LEFT JOIN links l ON l.target_url = t.url
+		WHERE ? = 0 OR COALESCE(t.job_id, l.job_id) = ?
+		ORDER BY t.url, l.id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.Query(query, ErrorRobotsBlocked, jobID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var broken []BrokenLink
+	for rows.Next() {
+		var b BrokenLink
+		var link Link
+		err := rows.Scan(&b.URL, &b.StatusCode, &b.ErrorCategory, &b.ErrorMessage, &b.Checked,
+			&link.SourceURL, &link.AnchorText, &link.Rel, &link.Element, &link.Kind,
+			&link.Internal, &link.JobID)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(broken); n == 0 || broken[n-1].URL != b.URL {
+			broken = append(broken, b)
+		}
+		if link.SourceURL != "" {
+			link.TargetURL = b.URL
+			last := &broken[len(broken)-1]
+			last.Sources = append(last.Sources, link)
+		}
+	}
+	return broken, rows.Err()
+}
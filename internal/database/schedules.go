@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Schedule is a recurring crawl of Seed with Options, started whenever its
+// cron expression matches.
+type Schedule struct {
+	ID      int64
+	Cron    string
+	Seed    string
+	Options json.RawMessage
+	// NextRunAt is when the schedule is due next.
+	NextRunAt time.Time
+	// LastRunAt and LastJobID are the time and job of the last run started,
+	// if any.
+	LastRunAt *time.Time
+	LastJobID int64
+	CreatedAt time.Time
+}
+
+const scheduleColumns = `id, cron, seed, options, next_run_at, last_run_at,
+	COALESCE(last_job_id, 0), created_at`
+
+// CreateSchedule records a new schedule and returns its ID.
+func (db *DB) CreateSchedule(s Schedule) (int64, error) {
+	query := `
+	INSERT INTO schedules (cron, seed, options, next_run_at, created_at)
+	VALUES (?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, s.Cron, s.Seed, string(s.Options), s.NextRunAt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetSchedule returns the schedule with the given ID, or ErrNotFound.
+func (db *DB) GetSchedule(id int64) (*Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM schedules WHERE id = ?`
+
+	s, err := scanSchedule(db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+// GetSchedules returns every schedule, oldest first.
+func (db *DB) GetSchedules() ([]Schedule, error) {
+	return db.querySchedules(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY id`)
+}
+
+// DueSchedules returns the schedules due at now.
+func (db *DB) DueSchedules(now time.Time) ([]Schedule, error) {
+	query := `
+		SELECT ` + scheduleColumns + `
+		FROM schedules
+		WHERE next_run_at <= ?
+		ORDER BY next_run_at, id`
+
+	return db.querySchedules(query, now)
+}
+
+// DeleteSchedule deletes a schedule, or returns ErrNotFound. The jobs it
+// started are kept.
+func (db *DB) DeleteSchedule(id int64) error {
+	result, err := db.Exec("DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordScheduleRun records that a schedule started jobID at ranAt, linking
+// the job to the schedule, and sets when the schedule is due next.
+func (db *DB) RecordScheduleRun(id, jobID int64, ranAt, next time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE schedules SET last_run_at = ?, last_job_id = ?, next_run_at = ?
+		WHERE id = ?`, ranAt, jobID, next, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE crawl_jobs SET schedule_id = ? WHERE id = ?", id, jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetScheduleNextRun sets when a schedule is due next, for runs that were
+// skipped.
+func (db *DB) SetScheduleNextRun(id int64, next time.Time) error {
+	_, err := db.Exec("UPDATE schedules SET next_run_at = ? WHERE id = ?", next, id)
+	return err
+}
+
+func (db *DB) querySchedules(query string, args ...interface{}) ([]Schedule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, rows.Err()
+}
+
+func scanSchedule(row scanner) (*Schedule, error) {
+	var s Schedule
+	var options string
+	var lastRunAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Cron, &s.Seed, &options, &s.NextRunAt, &lastRunAt,
+		&s.LastJobID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Options = json.RawMessage(options)
+	if lastRunAt.Valid {
+		s.LastRunAt = &lastRunAt.Time
+	}
+	return &s, nil
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Webhook is an endpoint notified of crawl events with signed JSON POST
+// requests.
+type Webhook struct {
+	ID  int64
+	URL string
+	// Secret is the key the payloads are signed with. It is only shown when
+	// the webhook is created.
+	Secret string `json:"-"`
+	// Events are the events the webhook is notified of, or empty for every
+	// event.
+	Events    []string
+	CreatedAt time.Time
+}
+
+// Subscribed reports whether the webhook is notified of event.
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is a notification sent, or being sent, to a webhook.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	Event     string
+	JobID     int64
+	Payload   json.RawMessage
+	State     string
+	// Attempts is the number of requests made, StatusCode and Error the
+	// outcome of the last one.
+	Attempts      int
+	StatusCode    int
+	Error         string
+	CreatedAt     time.Time
+	LastAttemptAt *time.Time
+}
+
+const deliveryColumns = `id, webhook_id, event, COALESCE(job_id, 0), payload, state,
+	attempts, status_code, error, created_at, last_attempt_at`
+
+// CreateWebhook records a new webhook and returns its ID.
+func (db *DB) CreateWebhook(w Webhook) (int64, error) {
+	query := `
+	INSERT INTO webhooks (url, secret, events, created_at)
+	VALUES (?, ?, ?, ?)`
+
+	result, err := db.Exec(query, w.URL, w.Secret, strings.Join(w.Events, ","), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetWebhook returns the webhook with the given ID, or ErrNotFound.
+func (db *DB) GetWebhook(id int64) (*Webhook, error) {
+	row := db.QueryRow(`SELECT id, url, secret, events, created_at FROM webhooks WHERE id = ?`, id)
+	w, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return w, err
+}
+
+// GetWebhooks returns every webhook, oldest first.
+func (db *DB) GetWebhooks() ([]Webhook, error) {
+	rows, err := db.Query(`SELECT id, url, secret, events, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook and its deliveries, or returns
+// ErrNotFound.
+func (db *DB) DeleteWebhook(id int64) error {
+	result, err := db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var w Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = []string{}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return &w, nil
+}
+
+// CreateDelivery records a pending delivery and returns its ID.
+func (db *DB) CreateDelivery(d WebhookDelivery) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event, job_id, payload, state, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, d.WebhookID, d.Event, nullInt64(d.JobID), string(d.Payload),
+		DeliveryPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateDelivery records the state of a delivery after an attempt.
+func (db *DB) UpdateDelivery(d WebhookDelivery) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET state = ?, attempts = ?, status_code = ?, error = ?, last_attempt_at = ?
+	WHERE id = ?`
+
+	_, err := db.Exec(query, d.State, d.Attempts, d.StatusCode, d.Error, d.LastAttemptAt, d.ID)
+	return err
+}
+
+// GetDeliveries returns the latest deliveries of a webhook, newest first.
+func (db *DB) GetDeliveries(webhookID int64) ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT 100`
+
+	return db.queryDeliveries(query, webhookID)
+}
+
+// PendingDeliveries returns the deliveries that were not finished when the
+// process stopped, oldest first.
+func (db *DB) PendingDeliveries() ([]WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE state = ?
+		ORDER BY id`
+
+	return db.queryDeliveries(query, DeliveryPending)
+}
+
+func (db *DB) queryDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		var lastAttemptAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.JobID, &payload, &d.State,
+			&d.Attempts, &d.StatusCode, &d.Error, &d.CreatedAt, &lastAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		if lastAttemptAt.Valid {
+			d.LastAttemptAt = &lastAttemptAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -13,6 +13,8 @@ import (
 type MetricsClient interface {
 	IncrementPagesProcessed(statusCode int, host string)
 	IncrementCrawlErrors()
+	IncrementCrawlsStopped(reason string)
+	IncrementRetries(host string)
 	TimeCrawl(duration time.Duration, host string)
 	IncrementAPIRequests(endpoint, method string, statusCode int)
 	TimeAPIRequest(endpoint string, duration time.Duration)
@@ -80,6 +82,20 @@ func (m *MetricsDD) GaugeLinksFound(count int, host string) {
 	m.client.Gauge("crawler.links_found", float64(count), tags, 1)
 }
 
+func (m *MetricsDD) IncrementCrawlsStopped(reason string) {
+	tags := []string{"reason:" + reason}
+	if err := m.client.Incr("crawler.crawls_stopped", tags, 1); err != nil {
+		log.Printf("Failed to send metric crawler.crawls_stopped: %v", err)
+	}
+}
+
+func (m *MetricsDD) IncrementRetries(host string) {
+	tags := []string{"host:" + host}
+	if err := m.client.Incr("crawler.retries", tags, 1); err != nil {
+		log.Printf("Failed to send metric crawler.retries: %v", err)
+	}
+}
+
 // Métriques pour l'API
 func (m *MetricsDD) IncrementAPIRequests(endpoint, method string, statusCode int) {
 	tags := []string{
@@ -11,6 +11,8 @@ func NewNoopMetrics() *NoopMetrics {
 
 func (m *NoopMetrics) IncrementPagesProcessed(statusCode int, host string)          {}
 func (m *NoopMetrics) IncrementCrawlErrors()                                        {}
+func (m *NoopMetrics) IncrementCrawlsStopped(reason string)                         {}
+func (m *NoopMetrics) IncrementRetries(host string)                                 {}
 func (m *NoopMetrics) TimeCrawl(duration time.Duration, host string)                {}
 func (m *NoopMetrics) IncrementAPIRequests(endpoint, method string, statusCode int) {}
 func (m *NoopMetrics) TimeAPIRequest(endpoint string, duration time.Duration)       {}
@@ -0,0 +1,80 @@
+package parser
+
+import "strings"
+
+// RobotsDirectives are the indexing and link following directives of a page,
+// given by robots meta tags and X-Robots-Tag headers.
+type RobotsDirectives struct {
+	NoIndex  bool
+	NoFollow bool
+}
+
+// Merge returns the directives set in either d or other.
+func (d RobotsDirectives) Merge(other RobotsDirectives) RobotsDirectives {
+	return RobotsDirectives{
+		NoIndex:  d.NoIndex || other.NoIndex,
+		NoFollow: d.NoFollow || other.NoFollow,
+	}
+}
+
+// ParseRobotsDirectives reads a comma-separated directive list such as
+// "noindex, nofollow", as found in robots meta tags. "none" stands for both
+// and unknown directives are ignored.
+func ParseRobotsDirectives(content string) RobotsDirectives {
+	var d RobotsDirectives
+	for _, directive := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex = true
+			d.NoFollow = true
+		}
+	}
+	return d
+}
+
+// valueDirectives are the directives taking a value after a colon, which
+// must not be mistaken for the user agent prefix of an X-Robots-Tag.
+var valueDirectives = []string{"unavailable_after", "max-snippet", "max-image-preview", "max-video-preview"}
+
+// ParseXRobotsTag reads the X-Robots-Tag header values of a response.
+// Values prefixed with a user agent, as in "googlebot: noindex", only apply
+// when the agent is token. The text before the first colon is only a user
+// agent when it is a single token, so "noindex, unavailable_after: ..." is a
+// plain directive list.
+func ParseXRobotsTag(values []string, token string) RobotsDirectives {
+	var d RobotsDirectives
+	for _, v := range values {
+		if agent, rest, ok := strings.Cut(v, ":"); ok && isUserAgent(agent) {
+			if !strings.EqualFold(strings.TrimSpace(agent), token) {
+				continue
+			}
+			v = rest
+		}
+		d = d.Merge(ParseRobotsDirectives(v))
+	}
+	return d
+}
+
+// isUserAgent reports whether the text before the colon of an X-Robots-Tag
+// value is a user agent rather than part of a directive list.
+func isUserAgent(prefix string) bool {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || strings.ContainsAny(prefix, ", \t") {
+		return false
+	}
+	return !isValueDirective(prefix)
+}
+
+func isValueDirective(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, directive := range valueDirectives {
+		if name == directive {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package parser
+
+import "testing"
+
+func TestParseRobotsDirectives(t *testing.T) {
+	tests := []struct {
+		content string
+		want    RobotsDirectives
+	}{
+		{"", RobotsDirectives{}},
+		{"index, follow", RobotsDirectives{}},
+		{"noindex", RobotsDirectives{NoIndex: true}},
+		{" NoFollow ", RobotsDirectives{NoFollow: true}},
+		{"noindex,nofollow", RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{"none", RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{"max-snippet:20, noarchive", RobotsDirectives{}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseRobotsDirectives(tt.content); got != tt.want {
+			t.Errorf("ParseRobotsDirectives(%q): want %+v, got %+v", tt.content, tt.want, got)
+		}
+	}
+}
+
+func TestParseXRobotsTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   RobotsDirectives
+	}{
+		{"no header", nil, RobotsDirectives{}},
+		{"all agents", []string{"noindex"}, RobotsDirectives{NoIndex: true}},
+		{"merged values", []string{"noindex", "nofollow"}, RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{"our agent", []string{"SpiderLite: nofollow"}, RobotsDirectives{NoFollow: true}},
+		{"other agent", []string{"googlebot: noindex, nofollow"}, RobotsDirectives{}},
+		{"value directive", []string{"unavailable_after: 25 Jun 2030 15:00:00 PST, noindex"}, RobotsDirectives{NoIndex: true}},
+		{"value directive after others", []string{"noindex, unavailable_after: 25 Jun 2030 15:00:00 PST"}, RobotsDirectives{NoIndex: true}},
+		{"agent with value directive", []string{"spiderlite: noindex, unavailable_after: 25 Jun 2030 15:00:00 PST"}, RobotsDirectives{NoIndex: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseXRobotsTag(tt.values, "spiderlite"); got != tt.want {
+				t.Errorf("want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Document holds what the crawler reads from an HTML page.
+type Document struct {
+	Title       string
+	Description string
+	// Canonical is the URL of the page's rel="canonical" link, if any.
+	Canonical *url.URL
+	// Robots are the directives of the page's robots meta tags.
+	Robots RobotsDirectives
+	// Links are the URLs referenced by the page, in document order,
+	// resolved against its base URL and normalized with NormalizeURL.
+	Links []Link
+}
+
+// ParseHTML reads an HTML document, resolving its URLs against base, or
+// against the document's <base href> when it has one.
+func ParseHTML(body io.Reader, base *url.URL) (*Document, error) {
+	tokens := html.NewTokenizer(body)
+	doc := &Document{Links: []Link{}}
+
+	// URLs are resolved once the whole document is read, as <base href>
+	// applies to the URLs appearing before it too.
+	var refs []reference
+	var baseHref, canonicalHref string
+	var seenBase, seenCanonical bool
+	add := func(href string, link Link) {
+		refs = append(refs, reference{href: href, link: link})
+	}
+
+	var inTitle, seenTitle bool
+	// anchor is the index in refs of the <a> being read, or -1
+	anchor := -1
+	var text strings.Builder
+	endAnchor := func() {
+		if anchor >= 0 {
+			refs[anchor].link.Text = strings.Join(strings.Fields(text.String()), " ")
+			anchor = -1
+			text.Reset()
+		}
+	}
+
+	var err error
+	for {
+		tt := tokens.Next()
+		if tt == html.ErrorToken {
+			if tokens.Err() != io.EOF {
+				err = tokens.Err()
+			}
+			break
+		}
+		token := tokens.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.DataAtom {
+			case atom.A:
+				// Anchors cannot be nested, a new one closes the previous
+				endAnchor()
+				if href, ok := lookupAttr(token, "href"); ok {
+					add(href, Link{Rel: attr(token, "rel"), Element: "a", Kind: KindNavigation})
+					if tt == html.StartTagToken {
+						anchor = len(refs) - 1
+					}
+				}
+			case atom.Area:
+				if href, ok := lookupAttr(token, "href"); ok {
+					add(href, Link{Text: attr(token, "alt"), Rel: attr(token, "rel"), Element: "area", Kind: KindNavigation})
+				}
+			case atom.Base:
+				if href, ok := lookupAttr(token, "href"); ok && !seenBase {
+					baseHref, seenBase = href, true
+				}
+			case atom.Iframe, atom.Frame:
+				if src := attr(token, "src"); src != "" {
+					add(src, Link{Element: token.Data, Kind: KindNavigation})
+				}
+			case atom.Img:
+				alt := attr(token, "alt")
+				if anchor >= 0 {
+					text.WriteString(" " + alt + " ")
+				}
+				if src := attr(token, "src"); src != "" {
+					add(src, Link{Text: alt, Element: "img", Kind: KindAsset})
+				}
+				for _, src := range parseSrcset(attr(token, "srcset")) {
+					add(src, Link{Text: alt, Element: "img", Kind: KindAsset})
+				}
+			case atom.Script:
+				if src := attr(token, "src"); src != "" {
+					add(src, Link{Element: "script", Kind: KindAsset})
+				}
+			case atom.Title:
+				inTitle = !seenTitle && tt == html.StartTagToken
+			case atom.Meta:
+				name := attr(token, "name")
+				if strings.EqualFold(name, "description") && doc.Description == "" {
+					doc.Description = strings.TrimSpace(attr(token, "content"))
+				}
+				if strings.EqualFold(name, "robots") {
+					doc.Robots = doc.Robots.Merge(ParseRobotsDirectives(attr(token, "content")))
+				}
+				if strings.EqualFold(attr(token, "http-equiv"), "refresh") {
+					if target := refreshURL(attr(token, "content")); target != "" {
+						add(target, Link{Element: "meta", Kind: KindRedirect})
+					}
+				}
+			case atom.Link:
+				href, rel := attr(token, "href"), attr(token, "rel")
+				if href == "" {
+					break
+				}
+				kind := relKind(rel)
+				if kind == KindCanonical && !seenCanonical {
+					canonicalHref, seenCanonical = href, true
+				}
+				if kind != "" {
+					add(href, Link{Rel: rel, Element: "link", Kind: kind})
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				doc.Title += token.Data
+			}
+			if anchor >= 0 {
+				text.WriteString(token.Data)
+			}
+		case html.EndTagToken:
+			if token.DataAtom == atom.A {
+				endAnchor()
+			}
+			if token.DataAtom == atom.Title && inTitle {
+				inTitle = false
+				seenTitle = true
+				doc.Title = strings.Join(strings.Fields(doc.Title), " ")
+			}
+		}
+	}
+	endAnchor()
+
+	if seenBase {
+		if u, err := base.Parse(strings.TrimSpace(baseHref)); err == nil {
+			base = u
+		}
+	}
+	for _, ref := range refs {
+		if ref.link.URL = resolve(base, ref.href); ref.link.URL != nil {
+			doc.Links = append(doc.Links, ref.link)
+		}
+	}
+	if seenCanonical {
+		doc.Canonical = resolve(base, canonicalHref)
+	}
+	return doc, err
+}
+
+// reference is a link whose URL has not been resolved yet.
+type reference struct {
+	href string
+	link Link
+}
+
+// attr returns the value of the named attribute of token, or "" if unset.
+func attr(token html.Token, name string) string {
+	v, _ := lookupAttr(token, name)
+	return v
+}
+
+// lookupAttr returns the value of the named attribute of token and whether
+// it is set.
+func lookupAttr(token html.Token, name string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// hasToken reports whether the space-separated list v contains token,
+// ignoring case.
+func hasToken(v, token string) bool {
+	for _, field := range strings.Fields(v) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve parses href relative to base and normalizes it. It returns nil
+// for invalid references.
+func resolve(base *url.URL, href string) *url.URL {
+	link, err := base.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil
+	}
+	return NormalizeURL(link)
+}
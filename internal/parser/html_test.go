@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseHTML(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/")
+
+	doc, err := ParseHTML(strings.NewReader(`<html><head>
+		<title>
+			Getting   started
+		</title>
+		<meta name="Description" content=" How to get started. ">
+		<meta name="robots" content="noindex">
+		<link rel="alternate stylesheet" href="/style.css">
+		<link rel="Canonical" href="../start#intro">
+	</head><body>
+		<svg><title>Icon</title></svg>
+		<a href="intro" rel="nofollow noopener">Intro
+			<b>page</b></a>
+		<a name="anchor">No link</a>
+		<a href=""><img src="/logo.png" alt="Home"></a>
+	</body></html>`), base)
+	if err != nil {
+		t.Fatalf("ParseHTML() error = %v", err)
+	}
+
+	if doc.Title != "Getting started" {
+		t.Errorf("Title: want %q, got %q", "Getting started", doc.Title)
+	}
+	if doc.Description != "How to get started." {
+		t.Errorf("Description: want %q, got %q", "How to get started.", doc.Description)
+	}
+	if doc.Canonical == nil || doc.Canonical.String() != "https://example.com/start" {
+		t.Errorf("Canonical: want https://example.com/start, got %v", doc.Canonical)
+	}
+
+	if want := (RobotsDirectives{NoIndex: true}); doc.Robots != want {
+		t.Errorf("Robots: want %+v, got %+v", want, doc.Robots)
+	}
+
+	want := []struct {
+		url, text, rel string
+	}{
+		{"https://example.com/style.css", "", "alternate stylesheet"},
+		{"https://example.com/start", "", "Canonical"},
+		{"https://example.com/docs/intro", "Intro page", "nofollow noopener"},
+		{"https://example.com/docs/", "Home", ""},
+		{"https://example.com/logo.png", "Home", ""},
+	}
+	if len(doc.Links) != len(want) {
+		t.Fatalf("Expected %d links, got %v", len(want), doc.Links)
+	}
+	for i, link := range doc.Links {
+		if link.URL.String() != want[i].url || link.Text != want[i].text || link.Rel != want[i].rel {
+			t.Errorf("Link %d: want %v, got %s %q %q", i, want[i], link.URL, link.Text, link.Rel)
+		}
+	}
+	if !doc.Links[2].NoFollow() || doc.Links[3].NoFollow() {
+		t.Errorf("Expected only the intro link to be nofollow")
+	}
+
+	empty, err := ParseHTML(strings.NewReader(`<p>No metadata</p>`), base)
+	if err != nil {
+		t.Fatalf("ParseHTML() error = %v", err)
+	}
+	if empty.Title != "" || empty.Description != "" || empty.Canonical != nil || empty.Robots != (RobotsDirectives{}) {
+		t.Errorf("Expected no metadata, got %+v", empty)
+	}
+}
@@ -4,31 +4,197 @@ import (
 	"io"
 	"net/url"
 	"strings"
+)
+
+// LinkKind tells what a link is used for.
+type LinkKind string
 
-	"golang.org/x/net/html"
+const (
+	// KindNavigation links lead to other documents: anchors, image map
+	// areas, frames and <link> relations such as next.
+	KindNavigation LinkKind = "navigation"
+	// KindAsset links load a resource of the page, such as an image, a
+	// script, a stylesheet or an icon.
+	KindAsset LinkKind = "asset"
+	// KindCanonical links point to the canonical URL of the page.
+	KindCanonical LinkKind = "canonical"
+	// KindAlternate links point to another version of the page, such as a
+	// translation or a feed.
+	KindAlternate LinkKind = "alternate"
+	// KindRedirect links are the targets of <meta http-equiv="refresh">
+	// redirects.
+	KindRedirect LinkKind = "redirect"
 )
 
-func ExtractLinks(body io.Reader, base *url.URL) ([]*url.URL, error) {
-	tokens := html.NewTokenizer(body)
-	links := []*url.URL{}
+// ElementLinkHeader is the Element of the links read from Link response
+// headers.
+const ElementLinkHeader = "link-header"
 
-	for {
-		tt := tokens.Next()
-		if tt == html.ErrorToken {
-			break
-		}
-		token := tokens.Token()
-		if token.Type == html.StartTagToken && token.DataAtom.String() == "a" {
-			for _, attr := range token.Attr {
-				if attr.Key == "href" {
-					href := strings.TrimSpace(attr.Val)
-					link, err := base.Parse(href)
-					if err == nil {
-						links = append(links, link)
-					}
-				}
+// Link is a URL referenced by a document.
+type Link struct {
+	URL *url.URL
+	// Text is the anchor text, falling back to the alt text of images.
+	Text string
+	// Rel is the value of the rel attribute.
+	Rel string
+	// Element is the name of the HTML element the link was found on, such
+	// as "a" or "img", or ElementLinkHeader.
+	Element string
+	Kind    LinkKind
+}
+
+// NoFollow reports whether the link is marked rel="nofollow".
+func (l Link) NoFollow() bool {
+	return hasToken(l.Rel, "nofollow")
+}
+
+// ExtractLinks returns the links of an HTML document with their element and
+// kind, resolved against base or the document's <base href> and normalized
+// with NormalizeURL.
+func ExtractLinks(body io.Reader, base *url.URL) ([]Link, error) {
+	doc, err := ParseHTML(body, base)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Links, nil
+}
+
+// ParseLinkHeader returns the links of Link response headers such as
+// `</style.css>; rel=preload, <https://example.com/>; rel="canonical"`,
+// resolved against base and normalized with NormalizeURL.
+func ParseLinkHeader(values []string, base *url.URL) []Link {
+	var links []Link
+	for _, v := range values {
+		for {
+			start := strings.IndexByte(v, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(v[start:], '>')
+			if end < 0 {
+				break
+			}
+			href := v[start+1 : start+end]
+
+			var params string
+			params, v = splitLinkValue(v[start+end+1:])
+			rel := linkParam(params, "rel")
+			kind := relKind(rel)
+			if kind == "" {
+				continue
+			}
+			if u := resolve(base, href); u != nil {
+				links = append(links, Link{URL: u, Rel: rel, Element: ElementLinkHeader, Kind: kind})
+			}
+		}
+	}
+	return links
+}
+
+// splitLinkValue splits the parameters of a Link header value from the
+// following links, at the first comma outside of a quoted string.
+func splitLinkValue(v string) (params, rest string) {
+	quoted := false
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return v[:i], v[i+1:]
 			}
 		}
 	}
-	return links, nil
+	return v, ""
+}
+
+// linkParam returns the value of the named parameter of a Link header.
+func linkParam(params, name string) string {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(param, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// assetRels are the <link> relations loading a resource of the page.
+var assetRels = []string{
+	"stylesheet", "icon", "apple-touch-icon", "mask-icon", "manifest",
+	"preload", "modulepreload", "prefetch",
+}
+
+// relKind returns the kind of a <link> element or Link header from its rel
+// value, or "" for relations naming an origin rather than a resource, such
+// as preconnect.
+func relKind(rel string) LinkKind {
+	switch {
+	case hasToken(rel, "preconnect") || hasToken(rel, "dns-prefetch"):
+		return ""
+	case hasToken(rel, "canonical"):
+		return KindCanonical
+	}
+	for _, assetRel := range assetRels {
+		if hasToken(rel, assetRel) {
+			return KindAsset
+		}
+	}
+	if hasToken(rel, "alternate") {
+		return KindAlternate
+	}
+	return KindNavigation
+}
+
+// refreshURL returns the URL of a meta refresh such as "5; url=/next", or ""
+// when the refresh only reloads the page.
+func refreshURL(content string) string {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return ""
+	}
+	target := strings.TrimSpace(content[i+1:])
+	if len(target) > 3 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	if len(target) > 1 && (target[0] == '"' || target[0] == '\'') {
+		if end := strings.IndexByte(target[1:], target[0]); end >= 0 {
+			target = target[1 : end+1]
+		} else {
+			target = target[1:]
+		}
+	}
+	return target
+}
+
+// parseSrcset returns the URLs of the image candidates of a srcset
+// attribute such as "small.png 1x, large.png 2x".
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for {
+		srcset = strings.TrimLeft(srcset, " \t\n\r\f,")
+		if srcset == "" {
+			return urls
+		}
+		end := strings.IndexAny(srcset, " \t\n\r\f")
+		if end < 0 {
+			end = len(srcset)
+		}
+		candidate := srcset[:end]
+		srcset = srcset[end:]
+
+		// A URL ending with commas has no descriptors, otherwise skip them
+		if trimmed := strings.TrimRight(candidate, ","); trimmed != candidate {
+			candidate = trimmed
+		} else if comma := strings.IndexByte(srcset, ','); comma >= 0 {
+			srcset = srcset[comma+1:]
+		} else {
+			srcset = ""
+		}
+		if candidate != "" {
+			urls = append(urls, candidate)
+		}
+	}
 }
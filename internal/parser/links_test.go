@@ -32,6 +32,15 @@ func TestExtractLinks(t *testing.T) {
 			baseURL:  "https://example.com",
 			expected: []string{"https://example.com/valid"},
 		},
+		{
+			name: "normalized links",
+			html: `<html><body>
+				<a href="/page#top">Top</a>
+				<a href="HTTPS://Example.com:443/a/../page2">Page 2</a>
+				</body></html>`,
+			baseURL:  "https://example.com",
+			expected: []string{"https://example.com/page", "https://example.com/page2"},
+		},
 		{
 			name:     "empty html",
 			html:     "",
@@ -53,10 +62,10 @@ func TestExtractLinks(t *testing.T) {
 				return
 			}
 
-			// Convert []*url.URL to []string for easier comparison
+			// Convert []Link to []string for easier comparison
 			got := make([]string, len(links))
 			for i, link := range links {
-				got[i] = link.String()
+				got[i] = link.URL.String()
 			}
 
 			// Compare results
@@ -73,3 +82,116 @@ func TestExtractLinks(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractTypedLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page.html")
+
+	links, err := ExtractLinks(strings.NewReader(`<html><head>
+		<link rel="stylesheet" href="css/site.css">
+		<link rel="canonical" href="/docs/page">
+		<link rel="alternate" hreflang="fr" href="/fr/docs/page">
+		<link rel="next" href="page2.html">
+		<link rel="preconnect" href="https://fonts.example.com">
+		<base href="https://static.example.com/v2/">
+		<meta http-equiv="Refresh" content="30; URL='moved.html'">
+		<script src="app.js"></script>
+	</head><body>
+		<a href="guide">Guide</a>
+		<img src="logo.png" srcset="logo-2x.png 2x, logo-3x.png 3x" alt="Logo">
+		<map><area href="/region" alt="Region"></map>
+		<iframe src="embed.html"></iframe>
+		<frame src="https://example.com/frame">
+	</body></html>`), base)
+	if err != nil {
+		t.Fatalf("ExtractLinks() error = %v", err)
+	}
+
+	want := []struct {
+		url, element string
+		kind         LinkKind
+	}{
+		{"https://static.example.com/v2/css/site.css", "link", KindAsset},
+		{"https://static.example.com/docs/page", "link", KindCanonical},
+		{"https://static.example.com/fr/docs/page", "link", KindAlternate},
+		{"https://static.example.com/v2/page2.html", "link", KindNavigation},
+		{"https://static.example.com/v2/moved.html", "meta", KindRedirect},
+		{"https://static.example.com/v2/app.js", "script", KindAsset},
+		{"https://static.example.com/v2/guide", "a", KindNavigation},
+		{"https://static.example.com/v2/logo.png", "img", KindAsset},
+		{"https://static.example.com/v2/logo-2x.png", "img", KindAsset},
+		{"https://static.example.com/v2/logo-3x.png", "img", KindAsset},
+		{"https://static.example.com/region", "area", KindNavigation},
+		{"https://static.example.com/v2/embed.html", "iframe", KindNavigation},
+		{"https://example.com/frame", "frame", KindNavigation},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Expected %d links, got %d: %v", len(want), len(links), links)
+	}
+	for i, link := range links {
+		if link.URL.String() != want[i].url || link.Element != want[i].element || link.Kind != want[i].kind {
+			t.Errorf("Link %d: want %v, got %s %s %s", i, want[i], link.URL, link.Element, link.Kind)
+		}
+	}
+	if links[7].Text != "Logo" || links[10].Text != "Region" {
+		t.Errorf("Expected alt texts to be kept, got %q and %q", links[7].Text, links[10].Text)
+	}
+}
+
+func TestParseLinkHeader(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/")
+
+	links := ParseLinkHeader([]string{
+		`</style.css>; rel=preload; as=style, <https://example.com/docs>; rel="canonical"`,
+		`<page2>; rel="next"; title="Page 2, continued", <https://cdn.example.com>; rel=preconnect`,
+	}, base)
+
+	want := []struct {
+		url  string
+		kind LinkKind
+	}{
+		{"https://example.com/style.css", KindAsset},
+		{"https://example.com/docs", KindCanonical},
+		{"https://example.com/docs/page2", KindNavigation},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Expected %d links, got %v", len(want), links)
+	}
+	for i, link := range links {
+		if link.URL.String() != want[i].url || link.Kind != want[i].kind || link.Element != ElementLinkHeader {
+			t.Errorf("Link %d: want %v, got %s %s %s", i, want[i], link.URL, link.Element, link.Kind)
+		}
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	tests := map[string]string{
+		"5":                         "",
+		"0; url=/next":              "/next",
+		"0;URL='https://a.example'": "https://a.example",
+		`3, url="page.html"`:        "page.html",
+		"0; /bare":                  "/bare",
+		"0; url=":                   "",
+	}
+	for content, want := range tests {
+		if got := refreshURL(content); got != want {
+			t.Errorf("refreshURL(%q): want %q, got %q", content, want, got)
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tests := map[string][]string{
+		"":                              nil,
+		"a.png":                         {"a.png"},
+		"a.png 1x, b.png 2x":            {"a.png", "b.png"},
+		"a.png 480w,b.png 800w":         {"a.png", "b.png"},
+		"a.png,, b.png 2x":              {"a.png", "b.png"},
+		"data:image/png;base64,AAA= 1x": {"data:image/png;base64,AAA="},
+	}
+	for srcset, want := range tests {
+		got := parseSrcset(srcset)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("parseSrcset(%q): want %q, got %q", srcset, want, got)
+		}
+	}
+}
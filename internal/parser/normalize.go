@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultStripParams are the tracking query parameters removed from URLs by
+// default. Patterns use path.Match syntax.
+var DefaultStripParams = []string{"utm_*", "gclid", "fbclid"}
+
+// Normalizer canonicalizes URLs so that variants of the same page share a
+// single key. The zero value strips fragments, lowercases the scheme and
+// host, drops default ports and resolves dot segments; StripParams and
+// SortQuery also rewrite the query string.
+type Normalizer struct {
+	// StripParams lists the query parameters to remove, as path.Match
+	// patterns such as "utm_*".
+	StripParams []string
+	// SortQuery orders the remaining query parameters.
+	SortQuery bool
+}
+
+// NormalizeURL canonicalizes u with the zero Normalizer.
+func NormalizeURL(u *url.URL) *url.URL {
+	return Normalizer{}.Normalize(u)
+}
+
+// Normalize returns a canonical copy of u. URLs other than http and https
+// only lose their fragment.
+func (n Normalizer) Normalize(u *url.URL) *url.URL {
+	norm := *u
+	norm.Fragment = ""
+	norm.RawFragment = ""
+
+	norm.Scheme = strings.ToLower(norm.Scheme)
+	if norm.Scheme != "http" && norm.Scheme != "https" || norm.Opaque != "" {
+		return &norm
+	}
+
+	host, port := strings.ToLower(norm.Hostname()), norm.Port()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" && !(norm.Scheme == "http" && port == "80") && !(norm.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	norm.Host = host
+
+	escaped := removeDotSegments(norm.EscapedPath())
+	if escaped == "" {
+		escaped = "/"
+	}
+	if p, err := url.PathUnescape(escaped); err == nil {
+		norm.Path = p
+		norm.RawPath = escaped
+	}
+
+	norm.RawQuery = n.normalizeQuery(norm.RawQuery)
+	norm.ForceQuery = false
+	return &norm
+}
+
+// normalizeQuery drops empty and stripped parameters from a raw query,
+// keeping the original encoding of the others.
+func (n Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(param, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if n.strip(key) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if n.SortQuery {
+		sort.Strings(params)
+	}
+	return strings.Join(params, "&")
+}
+
+func (n Normalizer) strip(key string) bool {
+	for _, pattern := range n.StripParams {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDotSegments resolves "." and ".." segments in a URL path as
+// described in RFC 3986, section 5.2.4.
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	var out []string
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	return strings.Join(out, "/")
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		url        string
+		expected   string
+	}{
+		{
+			name:     "fragment",
+			url:      "https://example.com/page#top",
+			expected: "https://example.com/page",
+		},
+		{
+			name:     "scheme and host case",
+			url:      "HTTPS://Example.COM/Page",
+			expected: "https://example.com/Page",
+		},
+		{
+			name:     "default http port",
+			url:      "http://example.com:80/page",
+			expected: "http://example.com/page",
+		},
+		{
+			name:     "default https port",
+			url:      "https://example.com:443/page",
+			expected: "https://example.com/page",
+		},
+		{
+			name:     "other port",
+			url:      "https://example.com:8443/page",
+			expected: "https://example.com:8443/page",
+		},
+		{
+			name:     "empty path",
+			url:      "https://example.com",
+			expected: "https://example.com/",
+		},
+		{
+			name:     "dot segments",
+			url:      "https://example.com/a/./b/../c/..",
+			expected: "https://example.com/a/",
+		},
+		{
+			name:     "dot segments above root",
+			url:      "https://example.com/../../page",
+			expected: "https://example.com/page",
+		},
+		{
+			name:     "escaped path kept",
+			url:      "https://example.com/a%2Fb/../c",
+			expected: "https://example.com/c",
+		},
+		{
+			name:     "empty query",
+			url:      "https://example.com/page?",
+			expected: "https://example.com/page",
+		},
+		{
+			name:     "query order kept by default",
+			url:      "https://example.com/page?b=2&a=1&utm_source=x",
+			expected: "https://example.com/page?b=2&a=1&utm_source=x",
+		},
+		{
+			name:       "stripped and sorted query",
+			normalizer: Normalizer{StripParams: DefaultStripParams, SortQuery: true},
+			url:        "https://example.com/page?utm_source=news&b=2&&a=1&gclid=abc&utm_medium=email",
+			expected:   "https://example.com/page?a=1&b=2",
+		},
+		{
+			name:       "only stripped params",
+			normalizer: Normalizer{StripParams: []string{"utm_*"}},
+			url:        "https://example.com/page?utm_source=news#top",
+			expected:   "https://example.com/page",
+		},
+		{
+			name:     "other scheme",
+			url:      "mailto:someone@Example.com#x",
+			expected: "mailto:someone@Example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+
+			got := tt.normalizer.Normalize(u).String()
+			if got != tt.expected {
+				t.Errorf("Normalize(%s): want %s, got %s", tt.url, tt.expected, got)
+			}
+			if again := tt.normalizer.Normalize(tt.normalizer.Normalize(u)).String(); again != got {
+				t.Errorf("Normalize is not idempotent: %s then %s", got, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxSitemapSize is the largest uncompressed sitemap read, as allowed by
+// the sitemaps.org protocol.
+const maxSitemapSize = 50 << 20
+
+// SitemapURL is a page listed in a sitemap urlset.
+type SitemapURL struct {
+	Loc     string
+	LastMod string
+	// Priority is nil when the sitemap does not set one.
+	Priority *float64
+}
+
+// Sitemap is either a urlset listing pages or a sitemap index listing
+// other sitemaps.
+type Sitemap struct {
+	URLs     []SitemapURL
+	Sitemaps []string
+}
+
+type sitemapXML struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc      string `xml:"loc"`
+		LastMod  string `xml:"lastmod"`
+		Priority string `xml:"priority"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// ParseSitemap parses a sitemap urlset or sitemap index, decompressing it
+// first if it is gzipped.
+func ParseSitemap(body io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(body)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var doc sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	sitemap := &Sitemap{}
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, u := range doc.URLs {
+			entry := SitemapURL{
+				Loc:     strings.TrimSpace(u.Loc),
+				LastMod: strings.TrimSpace(u.LastMod),
+			}
+			if entry.Loc == "" {
+				continue
+			}
+			if p, err := strconv.ParseFloat(strings.TrimSpace(u.Priority), 64); err == nil {
+				entry.Priority = &p
+			}
+			sitemap.URLs = append(sitemap.URLs, entry)
+		}
+	case "sitemapindex":
+		for _, s := range doc.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				sitemap.Sitemaps = append(sitemap.Sitemaps, loc)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected sitemap root element: %s", doc.XMLName.Local)
+	}
+	return sitemap, nil
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestParseSitemap(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+		<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url>
+				<loc>https://example.com/</loc>
+				<lastmod>2024-01-01</lastmod>
+				<priority>0.8</priority>
+			</url>
+			<url><loc> https://example.com/orphan </loc></url>
+			<url><loc></loc></url>
+		</urlset>`
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(urlset))
+	gz.Close()
+
+	for name, body := range map[string]string{"plain": urlset, "gzipped": gzipped.String()} {
+		t.Run(name, func(t *testing.T) {
+			sitemap, err := ParseSitemap(strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("ParseSitemap() error = %v", err)
+			}
+			if len(sitemap.URLs) != 2 {
+				t.Fatalf("Expected 2 URLs, got %d", len(sitemap.URLs))
+			}
+
+			first := sitemap.URLs[0]
+			if first.Loc != "https://example.com/" || first.LastMod != "2024-01-01" {
+				t.Errorf("Unexpected first entry: %+v", first)
+			}
+			if first.Priority == nil || *first.Priority != 0.8 {
+				t.Errorf("Expected priority 0.8, got %v", first.Priority)
+			}
+
+			second := sitemap.URLs[1]
+			if second.Loc != "https://example.com/orphan" || second.Priority != nil {
+				t.Errorf("Unexpected second entry: %+v", second)
+			}
+		})
+	}
+
+	t.Run("index", func(t *testing.T) {
+		index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<sitemap><loc>https://example.com/sitemap1.xml.gz</loc></sitemap>
+			<sitemap><loc>https://example.com/sitemap2.xml</loc></sitemap>
+		</sitemapindex>`
+
+		sitemap, err := ParseSitemap(strings.NewReader(index))
+		if err != nil {
+			t.Fatalf("ParseSitemap() error = %v", err)
+		}
+		if len(sitemap.Sitemaps) != 2 || len(sitemap.URLs) != 0 {
+			t.Errorf("Expected 2 child sitemaps, got %+v", sitemap)
+		}
+	})
+
+	t.Run("not a sitemap", func(t *testing.T) {
+		if _, err := ParseSitemap(strings.NewReader("<html><body></body></html>")); err == nil {
+			t.Errorf("Expected an error for an HTML document")
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression with the five standard fields: minute,
+// hour, day of month, month and day of week.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set when the day fields start with "*". As in
+	// Vixie cron, a day matches both day fields when either is a star, and
+	// either field otherwise.
+	domStar, dowStar bool
+}
+
+// cronField describes the values allowed in a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// Day of week 7 is Sunday, like 0.
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// cronMacros are the shorthands accepted instead of the five fields.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression such as "30 2 * * 1-5" or "@daily".
+// Fields accept "*", values, ranges ("1-5"), steps ("*/15", "0-30/10") and
+// comma-separated lists, and the month and day of week fields accept names
+// ("jan", "mon").
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		macro, ok := cronMacros[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron macro %q", expr)
+		}
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expr, len(fields))
+	}
+
+	var c Cron
+	var err error
+	if c.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return &c, nil
+}
+
+// parseCronField returns the values of a field as a bit set.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", st, f.name)
+			}
+			rng, step = r, n
+		}
+
+		var lo, hi int
+		switch lowStr, highStr, isRange := strings.Cut(rng, "-"); {
+		case rng == "*":
+			lo, hi = f.min, f.max
+		case isRange:
+			var err error
+			if lo, err = f.value(lowStr); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(highStr); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", rng, f.name)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			// "5/15" runs from 5 to the end of the range
+			hi = lo
+			if step > 1 {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return i + f.min, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, want %d-%d", s, f.name, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Next returns the first time after t matching the expression, in t's
+// location, or the zero time if none does within five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(c.hour, t.Hour()):
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// Hours repeated when clocks go back resolve to the first one
+			if !next.After(t) {
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *", "0 3 * * *", "*/15 9-17 * * mon-fri", "0,30 * 1,15 * *",
+		"5/20 * * jan,Jul *", "0 0 * * 7", "@daily", "@Hourly",
+	} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) error = %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *",
+		"@sometimes", "0 0 30 feb *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday
+	start := time.Date(2024, time.January, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * sat,sun", time.Date(2024, 1, 6, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 15 * fri", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */10 * *", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := cron.Next(start); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	cron, err := ParseCron("30 2 * * *")
+	if err != nil {
+		t.Fatalf("ParseCron() error = %v", err)
+	}
+
+	// 2:30 does not exist on the day clocks go forward
+	got := cron.Next(time.Date(2024, 3, 10, 0, 0, 0, 0, loc))
+	if want := time.Date(2024, 3, 11, 2, 30, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+
+	// Nor does Next loop when clocks go back
+	cron, _ = ParseCron("0 3 * * *")
+	got = cron.Next(time.Date(2024, 11, 3, 0, 30, 0, 0, loc))
+	if want := time.Date(2024, 11, 3, 3, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+// Package scheduler starts recurring crawls from the schedules stored in the
+// database.
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"spiderlite/internal/crawler"
+	"spiderlite/internal/database"
+)
+
+// DefaultInterval is how often the scheduler looks for due schedules.
+const DefaultInterval = 15 * time.Second
+
+// Scheduler submits a crawl job each time a schedule is due. A run is
+// skipped when the job started by the previous run of the same schedule has
+// not finished yet.
+type Scheduler struct {
+	db       *database.DB
+	crawler  *crawler.Crawler
+	interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a scheduler starting its crawls with c.
+func New(db *database.DB, c *crawler.Crawler) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		crawler:  c,
+		interval: DefaultInterval,
+	}
+}
+
+// Create validates and stores a schedule crawling startURL with opts
+// whenever the cron expression matches, in the server's local time.
+func (s *Scheduler) Create(expr string, startURL *url.URL, opts crawler.Options) (*database.Schedule, error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.db.CreateSchedule(database.Schedule{
+		Cron:      expr,
+		Seed:      startURL.String(),
+		Options:   encoded,
+		NextRunAt: cron.Next(time.Now()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %v", err)
+	}
+	return s.db.GetSchedule(id)
+}
+
+// Start looks for due schedules in the background until Stop is called.
+// Schedules that came due while the process was stopped run once.
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.runDue(time.Now())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops looking for due schedules. The crawls already started keep
+// running.
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.wg.Wait()
+	s.stop = nil
+}
+
+// runDue starts the runs of the schedules due at now.
+func (s *Scheduler) runDue(now time.Time) {
+	due, err := s.db.DueSchedules(now)
+	if err != nil {
+		log.Printf("Failed to fetch due schedules: %v", err)
+		return
+	}
+	for _, schedule := range due {
+		if err := s.run(schedule, now); err != nil {
+			log.Printf("Schedule %d run failed: %v", schedule.ID, err)
+		}
+	}
+}
+
+// run starts a crawl job for schedule, unless its previous job is still
+// active, and sets when the schedule is due next.
+func (s *Scheduler) run(schedule database.Schedule, now time.Time) error {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	next := cron.Next(now)
+
+	active, err := s.active(schedule.LastJobID)
+	if err != nil {
+		return err
+	}
+	if active {
+		log.Printf("Skipping run of schedule %d: job %d is still active", schedule.ID, schedule.LastJobID)
+		return s.db.SetScheduleNextRun(schedule.ID, next)
+	}
+
+	startURL, err := url.Parse(schedule.Seed)
+	if err != nil {
+		return fmt.Errorf("invalid seed: %v", err)
+	}
+	var opts crawler.Options
+	if len(schedule.Options) > 0 {
+		if err := json.Unmarshal(schedule.Options, &opts); err != nil {
+			return fmt.Errorf("invalid options: %v", err)
+		}
+	}
+
+	jobID, err := s.crawler.Submit(startURL, opts)
+	if err != nil {
+		// Try again at the next run rather than on every tick
+		if err := s.db.SetScheduleNextRun(schedule.ID, next); err != nil {
+			log.Printf("Failed to update schedule %d: %v", schedule.ID, err)
+		}
+		return err
+	}
+	log.Printf("Schedule %d started crawl job %d for: %s", schedule.ID, jobID, schedule.Seed)
+	return s.db.RecordScheduleRun(schedule.ID, jobID, now, next)
+}
+
+// active reports whether a job has not finished yet: it is queued, running
+// or paused.
+func (s *Scheduler) active(jobID int64) (bool, error) {
+	if jobID == 0 {
+		return false, nil
+	}
+	job, err := s.db.GetJob(jobID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch job.State {
+	case database.JobQueued, database.JobRunning, database.JobPaused:
+		return true, nil
+	}
+	return false, nil
+}
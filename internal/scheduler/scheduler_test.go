@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"spiderlite/internal/crawler"
+	"spiderlite/internal/database"
+	"spiderlite/internal/metrics"
+)
+
+func TestScheduler(t *testing.T) {
+	// The site answers once release is closed, so the first run is still
+	// active when the schedule is due again
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		<-release
+		w.Write([]byte(`<html><body>Home</body></html>`))
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	c := crawler.New(db, metrics.NewNoopMetrics())
+	defer c.Shutdown(context.Background())
+	s := New(db, c)
+
+	startURL, _ := url.Parse(ts.URL + "/")
+	if _, err := s.Create("not a cron", startURL, crawler.Options{}); err == nil {
+		t.Errorf("Expected an invalid cron expression to be rejected")
+	}
+	schedule, err := s.Create("*/5 * * * *", startURL, crawler.Options{MaxPages: 1})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !schedule.NextRunAt.After(time.Now()) || schedule.NextRunAt.Minute()%5 != 0 {
+		t.Errorf("Unexpected next run %v", schedule.NextRunAt)
+	}
+
+	// Not due yet
+	s.runDue(time.Now())
+	if jobs, _ := db.GetJobs(); len(jobs) != 0 {
+		t.Fatalf("Expected no job before the schedule is due, got %v", jobs)
+	}
+
+	now := schedule.NextRunAt
+	s.runDue(now)
+	jobs, err := db.GetJobs()
+	if err != nil {
+		t.Fatalf("GetJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ScheduleID != schedule.ID || string(jobs[0].Options) != `{"max_pages":1}` {
+		t.Fatalf("Expected a job started by schedule %d, got %+v", schedule.ID, jobs)
+	}
+	first := jobs[0].ID
+
+	schedule, err = db.GetSchedule(schedule.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule() error = %v", err)
+	}
+	if schedule.LastJobID != first || schedule.LastRunAt == nil || !schedule.NextRunAt.Equal(now.Add(5*time.Minute)) {
+		t.Errorf("Expected the run to be recorded, got %+v", schedule)
+	}
+
+	// The first job is still running: the run is skipped
+	now = schedule.NextRunAt
+	s.runDue(now)
+	if jobs, _ := db.GetJobs(); len(jobs) != 1 {
+		t.Errorf("Expected the overlapping run to be skipped, got %d jobs", len(jobs))
+	}
+	schedule, _ = db.GetSchedule(schedule.ID)
+	if schedule.LastJobID != first || !schedule.NextRunAt.Equal(now.Add(5*time.Minute)) {
+		t.Errorf("Expected the skipped run to only move the next run, got %+v", schedule)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := db.GetJob(first)
+		if err != nil {
+			t.Fatalf("GetJob() error = %v", err)
+		}
+		if job.State == database.JobCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %d did not complete, state %s", first, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.runDue(schedule.NextRunAt)
+	jobs, _ = db.GetJobs()
+	if len(jobs) != 2 || jobs[0].ScheduleID != schedule.ID {
+		t.Errorf("Expected a second job once the first completed, got %+v", jobs)
+	}
+
+	// Deleting the schedule keeps its jobs
+	if err := db.DeleteSchedule(schedule.ID); err != nil {
+		t.Fatalf("DeleteSchedule() error = %v", err)
+	}
+	if err := db.DeleteSchedule(schedule.ID); err != database.ErrNotFound {
+		t.Errorf("DeleteSchedule() error = %v, want ErrNotFound", err)
+	}
+	if job, err := db.GetJob(first); err != nil || job.ScheduleID != 0 {
+		t.Errorf("Expected job %d to be kept without its schedule, got %+v, %v", first, job, err)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"spiderlite/internal/crawler"
+	"spiderlite/internal/database"
+)
+
+func (s *Server) handleGetCrawls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs, err := s.db.GetJobs()
+	if err != nil {
+		log.Printf("Error fetching crawl jobs: %v", err)
+		http.Error(w, "Failed to fetch crawls: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(jobs),
+		"crawls": jobs,
+	})
+}
+
+// handleGetCrawlDiff compares the pages of the crawl jobs given by the from
+// and to query parameters.
+func (s *Server) handleGetCrawlDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var ids [2]int64
+	for i, name := range []string{"from", "to"} {
+		v := query.Get(name)
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid "+name+": "+v, http.StatusBadRequest)
+			return
+		}
+		ids[i] = id
+	}
+
+	diff, err := s.db.DiffCrawls(ids[0], ids[1])
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Crawl not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error comparing crawl jobs %d and %d: %v", ids[0], ids[1], err)
+		http.Error(w, "Failed to compare crawls: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// handleCrawlByID serves GET to fetch a crawl job and DELETE to cancel it.
+func (s *Server) handleCrawlByID(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetCrawl(w, r)
+	case http.MethodDelete:
+		s.handleCancelCrawl(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleGetCrawl(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) handleCancelCrawl(w http.ResponseWriter, r *http.Request) {
+	s.controlJob(w, r, s.crawler.Cancel, "cancelling")
+}
+
+func (s *Server) handlePauseCrawl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.controlJob(w, r, s.crawler.Pause, "pausing")
+}
+
+func (s *Server) handleResumeCrawl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.controlJob(w, r, s.crawler.Resume, "resumed")
+}
+
+// controlJob applies action to the job named by the {id} path parameter and
+// reports status on success.
+func (s *Server) controlJob(w http.ResponseWriter, r *http.Request, action func(int64) error, status string) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid crawl ID", http.StatusBadRequest)
+		return
+	}
+
+	err = action(id)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		http.Error(w, "Crawl not found", http.StatusNotFound)
+		return
+	case errors.Is(err, crawler.ErrJobNotActive), errors.Is(err, crawler.ErrJobNotPaused),
+		errors.Is(err, crawler.ErrJobRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error updating crawl job %d: %v", id, err)
+		http.Error(w, "Failed to update crawl: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"job_id": id,
+	})
+}
+
+// lookupJob loads the job named by the {id} path parameter, writing an
+// error response if it is invalid or does not exist.
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (*database.CrawlJob, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid crawl ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := s.db.GetJob(id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Crawl not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error fetching crawl job %d: %v", id, err)
+		http.Error(w, "Failed to fetch crawl: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// handleGetPageHistory lists the snapshots recorded by successive crawls of
+// the page given by the url query parameter, oldest first.
+func (s *Server) handleGetPageHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, ok := s.pageURL(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := s.db.GetPageHistory(target)
+	if err != nil {
+		log.Printf("Error fetching history of %s: %v", target, err)
+		http.Error(w, "Failed to fetch history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":     target,
+		"count":   len(history),
+		"history": history,
+	})
+}
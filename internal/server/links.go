@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"spiderlite/internal/database"
+)
+
+// handleGetInlinks lists the links pointing to the page given by the url
+// query parameter.
+func (s *Server) handleGetInlinks(w http.ResponseWriter, r *http.Request) {
+	s.handleLinks(w, r, s.db.GetInlinks)
+}
+
+// handleGetOutlinks lists the links found on the page given by the url
+// query parameter.
+func (s *Server) handleGetOutlinks(w http.ResponseWriter, r *http.Request) {
+	s.handleLinks(w, r, s.db.GetOutlinks)
+}
+
+func (s *Server) handleLinks(w http.ResponseWriter, r *http.Request, get func(string) ([]database.Link, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, ok := s.pageURL(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := get(target)
+	if err != nil {
+		log.Printf("Error fetching links of %s: %v", target, err)
+		http.Error(w, "Failed to fetch links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":   target,
+		"count": len(links),
+		"links": links,
+	})
+}
+
+// pageURL returns the page URL given by the url query parameter, normalized
+// by the crawler like stored URLs are. It writes a 400 response and returns
+// false when the parameter is missing or invalid.
+func (s *Server) pageURL(w http.ResponseWriter, r *http.Request) (string, bool) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, "Invalid URL: "+err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return s.crawler.Normalize(u).String(), true
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// handleGetRedirects lists the redirect chains longer than the longer_than
+// query parameter, one hop by default, along with every redirect loop.
+func (s *Server) handleGetRedirects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	minHops := 1
+	if v := query.Get("longer_than"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid longer_than: "+v, http.StatusBadRequest)
+			return
+		}
+		minHops = n
+	}
+	var loopsOnly bool
+	if v := query.Get("loops"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid loops: "+v, http.StatusBadRequest)
+			return
+		}
+		loopsOnly = b
+	}
+
+	chains, err := s.db.GetRedirectChains(minHops, loopsOnly)
+	if err != nil {
+		log.Printf("Error fetching redirects: %v", err)
+		http.Error(w, "Failed to fetch redirects: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(chains),
+		"redirects": chains,
+	})
+}
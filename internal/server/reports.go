@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// handleGetBrokenLinks lists the link targets that answered with a non-2xx
+// status or failed, with the pages linking to them. The job query parameter
+// restricts the report to one crawl job.
+func (s *Server) handleGetBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var jobID int64
+	if v := r.URL.Query().Get("job"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid job: "+v, http.StatusBadRequest)
+			return
+		}
+		jobID = id
+	}
+
+	broken, err := s.db.GetBrokenLinks(jobID)
+	if err != nil {
+		log.Printf("Error fetching broken links: %v", err)
+		http.Error(w, "Failed to fetch broken links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(broken),
+		"broken": broken,
+	})
+}
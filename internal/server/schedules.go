@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"spiderlite/internal/database"
+)
+
+// handleSchedules serves GET to list the crawl schedules and POST to create
+// one.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetSchedules(w, r)
+	case http.MethodPost:
+		s.handleCreateSchedule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleGetSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.db.GetSchedules()
+	if err != nil {
+		log.Printf("Error fetching schedules: %v", err)
+		http.Error(w, "Failed to fetch schedules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(schedules),
+		"schedules": schedules,
+	})
+}
+
+// handleCreateSchedule creates a schedule crawling the url query parameter
+// whenever the cron query parameter matches, with the crawl options of
+// POST /crawl.
+func (s *Server) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	targetURL := query.Get("url")
+	if targetURL == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		http.Error(w, "Invalid URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	expr := query.Get("cron")
+	if expr == "" {
+		http.Error(w, "Cron parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseCrawlOptions(query)
+	if err != nil {
+		http.Error(w, "Invalid crawl options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := s.scheduler.Create(expr, parsedURL, opts)
+	if err != nil {
+		http.Error(w, "Invalid schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Created schedule %d (%s) for: %s", schedule.ID, schedule.Cron, schedule.Seed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// handleScheduleByID serves GET to fetch a schedule and DELETE to delete it.
+func (s *Server) handleScheduleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := s.db.GetSchedule(id)
+		if !s.scheduleFound(w, id, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+	case http.MethodDelete:
+		if !s.scheduleFound(w, id, s.db.DeleteSchedule(id)) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "deleted",
+			"schedule_id": id,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// scheduleFound writes an error response for err, if any, and reports
+// whether the request on schedule id succeeded.
+func (s *Server) scheduleFound(w http.ResponseWriter, id int64, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error on schedule %d: %v", id, err)
+		http.Error(w, "Failed to fetch schedule: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
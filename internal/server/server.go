@@ -1,29 +1,42 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"slices"
 	"spiderlite/internal/crawler"
 	"spiderlite/internal/database"
 	"spiderlite/internal/metrics"
+	"spiderlite/internal/scheduler"
+	"spiderlite/internal/webhook"
 	"strconv"
+	"time"
 )
 
 type Server struct {
-	db      *database.DB
-	metrics metrics.MetricsClient
-	crawler *crawler.Crawler
+	db         *database.DB
+	metrics    metrics.MetricsClient
+	crawler    *crawler.Crawler
+	scheduler  *scheduler.Scheduler
+	webhooks   *webhook.Dispatcher
+	httpServer *http.Server
 }
 
-func New(db *database.DB, m metrics.MetricsClient) *Server {
-	return &Server{
-		db:      db,
-		metrics: m,
-		crawler: crawler.New(db, m),
+func New(db *database.DB, m metrics.MetricsClient, opts ...crawler.Option) *Server {
+	s := &Server{
+		db:       db,
+		metrics:  m,
+		webhooks: webhook.New(db),
 	}
+	s.crawler = crawler.New(db, m, append([]crawler.Option{crawler.WithNotifier(s.webhooks)}, opts...)...)
+	s.scheduler = scheduler.New(db, s.crawler)
+	s.httpServer = &http.Server{Handler: s.routes()}
+	return s
 }
 
 func (s *Server) handleCrawl(w http.ResponseWriter, r *http.Request) {
@@ -49,24 +62,111 @@ func (s *Server) handleCrawl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Launch crawl in a goroutine
-	go func() {
-		log.Printf("Starting crawl for: %s", parsedURL.String())
-		if err := s.crawler.Start(parsedURL); err != nil {
-			log.Printf("Crawl error: %v", err)
-			s.metrics.IncrementCrawlErrors()
-		}
-	}()
+	opts, err := parseCrawlOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid crawl options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Launch crawl in the background
+	jobID, err := s.crawler.Submit(parsedURL, opts)
+	if err != nil {
+		log.Printf("Failed to submit crawl: %v", err)
+		http.Error(w, "Failed to start crawl: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	response := map[string]string{
+	response := map[string]interface{}{
 		"status":  "started",
 		"message": "Crawl started for " + targetURL,
+		"job_id":  jobID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseCrawlOptions reads the crawl limits, settings and scope rules from the
+// query parameters of a crawl request.
+func parseCrawlOptions(query url.Values) (crawler.Options, error) {
+	var opts crawler.Options
+
+	if v := query.Get("max_depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid max_depth: %s", v)
+		}
+		opts.MaxDepth = n
+	}
+	if v := query.Get("max_pages"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid max_pages: %s", v)
+		}
+		opts.MaxPages = n
+	}
+	if v := query.Get("max_duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid max_duration: %s", v)
+		}
+		opts.MaxDuration = d
+	}
+	if v := query.Get("sitemaps"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid sitemaps: %s", v)
+		}
+		opts.SkipSitemaps = !b
+	}
+
+	if v := query.Get("check_external"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid check_external: %s", v)
+		}
+		opts.CheckExternal = b
+	}
+
+	if v := query.Get("check_assets"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid check_assets: %s", v)
+		}
+		opts.CheckAssets = b
+	}
+	if v := query.Get("ignore_nofollow"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid ignore_nofollow: %s", v)
+		}
+		opts.IgnoreNoFollow = b
+	}
+	if v := query.Get("full_recrawl"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid full_recrawl: %s", v)
+		}
+		opts.FullRecrawl = b
+	}
+
+	opts.AllowedHosts = query["allow_host"]
+	if v := query.Get("subdomains"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid subdomains: %s", v)
+		}
+		opts.IncludeSubdomains = b
+	}
+	opts.PathPrefixes = query["path_prefix"]
+	opts.Include = query["include"]
+	opts.Exclude = query["exclude"]
+	if err := opts.Validate(); err != nil {
+		return opts, fmt.Errorf("invalid scope: %v", err)
+	}
+	return opts, nil
+}
+
 func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
 	var debug struct {
 		DatabasePath string           `json:"database_path"`
@@ -93,33 +193,100 @@ func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get table list
+	// The database uses a single connection, so collect the names before
+	// counting rows.
+	var tableNames []string
 	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type='table'")
 	if err == nil {
-		defer rows.Close()
 		for rows.Next() {
 			var tableName string
 			if err := rows.Scan(&tableName); err == nil {
-				var count int64
-				if err := s.db.QueryRow("SELECT COUNT(*) FROM " + tableName).Scan(&count); err == nil {
-					debug.Tables[tableName] = count
-				}
+				tableNames = append(tableNames, tableName)
 			}
 		}
+		rows.Close()
+	}
+	for _, tableName := range tableNames {
+		var count int64
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + tableName).Scan(&count); err == nil {
+			debug.Tables[tableName] = count
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(debug)
 }
 
+// Start resumes interrupted crawls and serves the API on addr. It blocks
+// until the server fails or Shutdown is called, in which case it returns nil.
 func (s *Server) Start(addr string) error {
+	if err := s.crawler.ResumeJobs(); err != nil {
+		log.Printf("Failed to resume crawls: %v", err)
+	}
+	if err := s.webhooks.ResumeDeliveries(); err != nil {
+		log.Printf("Failed to resume webhook deliveries: %v", err)
+	}
+	s.scheduler.Start()
+
+	s.httpServer.Addr = addr
+	if err := s.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, waits for the handlers in progress,
+// stops the scheduler, then interrupts the running crawls and webhook
+// deliveries so they resume on the next start. It gives up waiting when ctx
+// is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Printf("Shutting down HTTP server...")
+	httpErr := s.httpServer.Shutdown(ctx)
+	if httpErr != nil {
+		log.Printf("HTTP server shutdown error: %v", httpErr)
+	}
+
+	s.scheduler.Stop()
+
+	log.Printf("Interrupting running crawls...")
+	crawlErr := s.crawler.Shutdown(ctx)
+	if crawlErr != nil {
+		log.Printf("Crawler shutdown error: %v", crawlErr)
+	}
+
+	log.Printf("Stopping webhook deliveries...")
+	webhookErr := s.webhooks.Shutdown(ctx)
+	if webhookErr != nil {
+		log.Printf("Webhook shutdown error: %v", webhookErr)
+	}
+
+	return errors.Join(httpErr, crawlErr, webhookErr)
+}
+
+func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/pages", metricsMiddleware(s.metrics, "/pages")(s.handleGetPages))
 	mux.HandleFunc("/pages/status", metricsMiddleware(s.metrics, "/pages/status")(s.handleGetPagesByStatus))
+	mux.HandleFunc("/pages/inlinks", metricsMiddleware(s.metrics, "/pages/inlinks")(s.handleGetInlinks))
+	mux.HandleFunc("/pages/outlinks", metricsMiddleware(s.metrics, "/pages/outlinks")(s.handleGetOutlinks))
+	mux.HandleFunc("/pages/history", metricsMiddleware(s.metrics, "/pages/history")(s.handleGetPageHistory))
+	mux.HandleFunc("/redirects", metricsMiddleware(s.metrics, "/redirects")(s.handleGetRedirects))
+	mux.HandleFunc("/reports/broken", metricsMiddleware(s.metrics, "/reports/broken")(s.handleGetBrokenLinks))
 	mux.HandleFunc("/crawl", metricsMiddleware(s.metrics, "/crawl")(s.handleCrawl))
+	mux.HandleFunc("/crawls", metricsMiddleware(s.metrics, "/crawls")(s.handleGetCrawls))
+	mux.HandleFunc("/crawls/diff", metricsMiddleware(s.metrics, "/crawls/diff")(s.handleGetCrawlDiff))
+	mux.HandleFunc("/crawls/{id}", metricsMiddleware(s.metrics, "/crawls/{id}")(s.handleCrawlByID))
+	mux.HandleFunc("/crawls/{id}/pause", metricsMiddleware(s.metrics, "/crawls/{id}/pause")(s.handlePauseCrawl))
+	mux.HandleFunc("/crawls/{id}/resume", metricsMiddleware(s.metrics, "/crawls/{id}/resume")(s.handleResumeCrawl))
+	mux.HandleFunc("/schedules", metricsMiddleware(s.metrics, "/schedules")(s.handleSchedules))
+	mux.HandleFunc("/schedules/{id}", metricsMiddleware(s.metrics, "/schedules/{id}")(s.handleScheduleByID))
+	mux.HandleFunc("/webhooks", metricsMiddleware(s.metrics, "/webhooks")(s.handleWebhooks))
+	mux.HandleFunc("/webhooks/{id}", metricsMiddleware(s.metrics, "/webhooks/{id}")(s.handleWebhookByID))
+	mux.HandleFunc("/webhooks/{id}/deliveries", metricsMiddleware(s.metrics, "/webhooks/{id}/deliveries")(s.handleGetDeliveries))
 	mux.HandleFunc("/debug", s.handleDebug)
 
-	return http.ListenAndServe(addr, mux)
+	return mux
 }
 
 func (s *Server) handleGetPages(w http.ResponseWriter, r *http.Request) {
@@ -128,8 +295,30 @@ func (s *Server) handleGetPages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Fetching pages from database...")
-	pages, err := s.db.GetPages()
+	var pages []database.PageData
+	var err error
+	if category, ok := r.URL.Query()["error"]; ok {
+		// "any" matches every failed page
+		filter := category[0]
+		if filter == "any" {
+			filter = ""
+		} else if !slices.Contains(database.ErrorCategories, filter) {
+			http.Error(w, "Invalid error category: "+filter, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Fetching pages with error %s from database...", category[0])
+		pages, err = s.db.GetPagesByError(filter)
+	} else if directive := r.URL.Query().Get("robots"); directive != "" {
+		if directive != database.DirectiveNoIndex && directive != database.DirectiveNoFollow {
+			http.Error(w, "Invalid robots directive: "+directive, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Fetching %s pages from database...", directive)
+		pages, err = s.db.GetPagesByDirective(directive)
+	} else {
+		log.Printf("Fetching pages from database...")
+		pages, err = s.db.GetPages()
+	}
 	if err != nil {
 		log.Printf("Error fetching pages: %v", err)
 		http.Error(w, "Failed to fetch pages: "+err.Error(), http.StatusInternalServerError)
@@ -1,10 +1,17 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
+	"time"
 
+	"spiderlite/internal/crawler"
 	"spiderlite/internal/database"
 	"spiderlite/internal/metrics"
 )
@@ -23,11 +30,17 @@ func TestServer(t *testing.T) {
 	// Create server
 	srv := New(db, m)
 
+	jobID, err := db.CreateJob("https://example.com", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
 	// Test cases
 	tests := []struct {
 		name       string
 		method     string
 		path       string
+		id         string
 		wantStatus int
 	}{
 		{
@@ -36,30 +49,346 @@ func TestServer(t *testing.T) {
 			path:       "/pages",
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:       "get pages with error",
+			method:     "GET",
+			path:       "/pages?error=timeout",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get pages with any error",
+			method:     "GET",
+			path:       "/pages?error=any",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get pages with unknown error",
+			method:     "GET",
+			path:       "/pages?error=gremlins",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get noindex pages",
+			method:     "GET",
+			path:       "/pages?robots=noindex",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get pages with unknown robots directive",
+			method:     "GET",
+			path:       "/pages?robots=noarchive",
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:       "get pages wrong method",
 			method:     "POST",
 			path:       "/pages",
 			wantStatus: http.StatusMethodNotAllowed,
 		},
+		{
+			name:       "get inlinks",
+			method:     "GET",
+			path:       "/pages/inlinks?url=https://example.com/missing",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get inlinks without url",
+			method:     "GET",
+			path:       "/pages/inlinks",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get outlinks",
+			method:     "GET",
+			path:       "/pages/outlinks?url=https://example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get outlinks wrong method",
+			method:     "POST",
+			path:       "/pages/outlinks?url=https://example.com",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "get page history",
+			method:     "GET",
+			path:       "/pages/history?url=https://example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get page history without url",
+			method:     "GET",
+			path:       "/pages/history",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get redirects",
+			method:     "GET",
+			path:       "/redirects?longer_than=2&loops=true",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get redirects with invalid length",
+			method:     "GET",
+			path:       "/redirects?longer_than=long",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get broken links",
+			method:     "GET",
+			path:       "/reports/broken",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get broken links of a job",
+			method:     "GET",
+			path:       "/reports/broken?job=1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get broken links with invalid job",
+			method:     "GET",
+			path:       "/reports/broken?job=latest",
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:       "crawl without url",
 			method:     "POST",
 			path:       "/crawl",
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:       "crawl with invalid limit",
+			method:     "POST",
+			path:       "/crawl?url=https://example.com&max_depth=deep",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "crawl with invalid scope pattern",
+			method:     "POST",
+			path:       "/crawl?url=https://example.com&exclude=re:(",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "list crawls",
+			method:     "GET",
+			path:       "/crawls",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get crawl",
+			method:     "GET",
+			path:       "/crawls/{id}",
+			id:         strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get unknown crawl",
+			method:     "GET",
+			path:       "/crawls/{id}",
+			id:         "999",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "get crawl with invalid id",
+			method:     "GET",
+			path:       "/crawls/{id}",
+			id:         "abc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "pause crawl that is not running",
+			method:     "POST",
+			path:       "/crawls/{id}/pause",
+			id:         strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "resume crawl that is not paused",
+			method:     "POST",
+			path:       "/crawls/{id}/resume",
+			id:         strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "diff crawls",
+			method:     "GET",
+			path:       "/crawls/diff?from=" + strconv.FormatInt(jobID, 10) + "&to=" + strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "diff unknown crawl",
+			method:     "GET",
+			path:       "/crawls/diff?from=" + strconv.FormatInt(jobID, 10) + "&to=999",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "diff crawls without to",
+			method:     "GET",
+			path:       "/crawls/diff?from=1",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "create schedule",
+			method:     "POST",
+			path:       "/schedules?url=https://example.com&cron=0+3+*+*+*&max_pages=100",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create schedule with invalid cron",
+			method:     "POST",
+			path:       "/schedules?url=https://example.com&cron=0+25+*+*+*",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "create schedule without cron",
+			method:     "POST",
+			path:       "/schedules?url=https://example.com",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "list schedules",
+			method:     "GET",
+			path:       "/schedules",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get schedule",
+			method:     "GET",
+			path:       "/schedules/{id}",
+			id:         "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete schedule",
+			method:     "DELETE",
+			path:       "/schedules/{id}",
+			id:         "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete unknown schedule",
+			method:     "DELETE",
+			path:       "/schedules/{id}",
+			id:         "1",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "create webhook",
+			method:     "POST",
+			path:       "/webhooks?url=https://hooks.example.com/crawls&event=job.failed&event=job.new_broken",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create webhook with invalid url",
+			method:     "POST",
+			path:       "/webhooks?url=ftp://hooks.example.com",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "create webhook with invalid event",
+			method:     "POST",
+			path:       "/webhooks?url=https://hooks.example.com&event=job.started",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "list webhooks",
+			method:     "GET",
+			path:       "/webhooks",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get webhook deliveries",
+			method:     "GET",
+			path:       "/webhooks/{id}/deliveries",
+			id:         "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get unknown webhook deliveries",
+			method:     "GET",
+			path:       "/webhooks/{id}/deliveries",
+			id:         "999",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "delete webhook",
+			method:     "DELETE",
+			path:       "/webhooks/{id}",
+			id:         "1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get deleted webhook",
+			method:     "GET",
+			path:       "/webhooks/{id}",
+			id:         "1",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "cancel unknown crawl",
+			method:     "DELETE",
+			path:       "/crawls/{id}",
+			id:         "999",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "cancel queued crawl",
+			method:     "DELETE",
+			path:       "/crawls/{id}",
+			id:         strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "cancel cancelled crawl",
+			method:     "DELETE",
+			path:       "/crawls/{id}",
+			id:         strconv.FormatInt(jobID, 10),
+			wantStatus: http.StatusConflict,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.SetPathValue("id", tt.id)
 			w := httptest.NewRecorder()
 
-			switch tt.path {
+			switch req.URL.Path {
 			case "/pages":
 				srv.handleGetPages(w, req)
+			case "/pages/inlinks":
+				srv.handleGetInlinks(w, req)
+			case "/pages/outlinks":
+				srv.handleGetOutlinks(w, req)
+			case "/pages/history":
+				srv.handleGetPageHistory(w, req)
+			case "/redirects":
+				srv.handleGetRedirects(w, req)
+			case "/reports/broken":
+				srv.handleGetBrokenLinks(w, req)
 			case "/crawl":
 				srv.handleCrawl(w, req)
+			case "/crawls":
+				srv.handleGetCrawls(w, req)
+			case "/crawls/diff":
+				srv.handleGetCrawlDiff(w, req)
+			case "/crawls/{id}":
+				srv.handleCrawlByID(w, req)
+			case "/crawls/{id}/pause":
+				srv.handlePauseCrawl(w, req)
+			case "/crawls/{id}/resume":
+				srv.handleResumeCrawl(w, req)
+			case "/schedules":
+				srv.handleSchedules(w, req)
+			case "/schedules/{id}":
+				srv.handleScheduleByID(w, req)
+			case "/webhooks":
+				srv.handleWebhooks(w, req)
+			case "/webhooks/{id}":
+				srv.handleWebhookByID(w, req)
+			case "/webhooks/{id}/deliveries":
+				srv.handleGetDeliveries(w, req)
 			}
 
 			if w.Code != tt.wantStatus {
@@ -68,3 +397,94 @@ func TestServer(t *testing.T) {
 		})
 	}
 }
+
+func TestServerPageURL(t *testing.T) {
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	srv := New(db, metrics.NewNoopMetrics())
+
+	// Stored as the crawler normalizes it: tracking parameters stripped and
+	// the query sorted
+	source := "https://example.com/search?a=1&b=2"
+	links := []database.Link{{TargetURL: "https://example.com/result"}}
+	if err := db.StoreLinks(source, 0, links); err != nil {
+		t.Fatalf("Failed to store links: %v", err)
+	}
+
+	target := "https://example.com/search?b=2&utm_source=newsletter&a=1"
+	req := httptest.NewRequest("GET", "/pages/outlinks?url="+url.QueryEscape(target), nil)
+	w := httptest.NewRecorder()
+	srv.handleGetOutlinks(w, req)
+
+	var resp struct {
+		URL   string
+		Count int
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.URL != source {
+		t.Errorf("Expected %s to be looked up as %s, got %s", target, source, resp.URL)
+	}
+	if resp.Count != 1 {
+		t.Errorf("Expected 1 outlink, got %d", resp.Count)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	// A slow site so the crawl is still running at shutdown
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, `<html><body><a href="%sx">Next</a></body></html>`, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	srv := New(db, metrics.NewNoopMetrics())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Start("127.0.0.1:0")
+	}()
+
+	startURL, _ := url.Parse(ts.URL + "/")
+	jobID, err := srv.crawler.Submit(startURL, crawler.Options{})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("Start() returned %v after shutdown", err)
+	}
+
+	// The interrupted crawl is queued to resume on the next start
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if job.State != database.JobQueued {
+		t.Errorf("Expected job to be queued after shutdown, got %s", job.State)
+	}
+	unfinished, err := db.UnfinishedJobs()
+	if err != nil {
+		t.Fatalf("UnfinishedJobs() error = %v", err)
+	}
+	if len(unfinished) != 1 {
+		t.Errorf("Expected 1 job to resume, got %d", len(unfinished))
+	}
+}
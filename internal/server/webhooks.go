@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"spiderlite/internal/database"
+	"spiderlite/internal/webhook"
+)
+
+// handleWebhooks serves GET to list the webhooks and POST to create one.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetWebhooks(w, r)
+	case http.MethodPost:
+		s.handleCreateWebhook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.db.GetWebhooks()
+	if err != nil {
+		log.Printf("Error fetching webhooks: %v", err)
+		http.Error(w, "Failed to fetch webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":    len(webhooks),
+		"webhooks": webhooks,
+	})
+}
+
+// handleCreateWebhook creates a webhook posting to the url query parameter.
+// The optional, repeatable event parameter restricts the events sent, and
+// secret sets the key payloads are signed with, generated when not given.
+// The response is the only one showing the secret.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	target := query.Get("url")
+	if target == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid URL: "+target, http.StatusBadRequest)
+		return
+	}
+
+	hook := database.Webhook{URL: u.String(), Secret: query.Get("secret")}
+	for _, event := range query["event"] {
+		if !webhook.ValidEvent(event) {
+			http.Error(w, "Invalid event: "+event, http.StatusBadRequest)
+			return
+		}
+		hook.Events = append(hook.Events, event)
+	}
+	if hook.Secret == "" {
+		if hook.Secret, err = webhook.NewSecret(); err != nil {
+			http.Error(w, "Failed to generate secret: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	hook.ID, err = s.db.CreateWebhook(hook)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Failed to create webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created, err := s.db.GetWebhook(hook.ID)
+	if !s.webhookFound(w, hook.ID, err) {
+		return
+	}
+	log.Printf("Created webhook %d for: %s", created.ID, created.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*database.Webhook
+		Secret string
+	}{created, created.Secret})
+}
+
+// handleWebhookByID serves GET to fetch a webhook and DELETE to delete it
+// along with its delivery log.
+func (s *Server) handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hook, err := s.db.GetWebhook(id)
+		if !s.webhookFound(w, id, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hook)
+	case http.MethodDelete:
+		if !s.webhookFound(w, id, s.db.DeleteWebhook(id)) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "deleted",
+			"webhook_id": id,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetDeliveries lists the latest deliveries of a webhook, newest
+// first.
+func (s *Server) handleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.db.GetWebhook(id); !s.webhookFound(w, id, err) {
+		return
+	}
+
+	deliveries, err := s.db.GetDeliveries(id)
+	if err != nil {
+		log.Printf("Error fetching deliveries of webhook %d: %v", id, err)
+		http.Error(w, "Failed to fetch deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhook_id": id,
+		"count":      len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// webhookID parses the {id} path parameter, writing a 400 response when it
+// is invalid.
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// webhookFound writes an error response for err, if any, and reports
+// whether the request on webhook id succeeded.
+func (s *Server) webhookFound(w http.ResponseWriter, id int64, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error on webhook %d: %v", id, err)
+		http.Error(w, "Failed to fetch webhook: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
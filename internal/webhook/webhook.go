@@ -0,0 +1,311 @@
+// Package webhook notifies the configured webhooks of crawl events with
+// signed JSON POST requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"spiderlite/internal/database"
+)
+
+// Events sent to webhooks.
+const (
+	// EventJobCompleted is sent when a crawl job completes.
+	EventJobCompleted = "job.completed"
+	// EventJobFailed is sent when a crawl job fails.
+	EventJobFailed = "job.failed"
+	// EventNewBroken is sent when a completed job found broken pages or
+	// checked links that were working, or not crawled, in the previous
+	// completed job of the same seed.
+	EventNewBroken = "job.new_broken"
+)
+
+// Events lists every event.
+var Events = []string{EventJobCompleted, EventJobFailed, EventNewBroken}
+
+// Headers of the webhook requests.
+const (
+	HeaderEvent    = "X-Spiderlite-Event"
+	HeaderDelivery = "X-Spiderlite-Delivery"
+	// HeaderSignature holds "sha256=" followed by the hex encoded HMAC-SHA256
+	// of the request body, keyed with the webhook secret.
+	HeaderSignature = "X-Spiderlite-Signature"
+)
+
+// Default delivery policy.
+const (
+	DefaultRetries      = 3
+	DefaultRetryBackoff = 2 * time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	Event string            `json:"event"`
+	Job   database.CrawlJob `json:"job"`
+	// PreviousJobID and NewBroken are set for EventNewBroken: the job
+	// compared against and the pages that broke since.
+	PreviousJobID int64                 `json:"previous_job_id,omitempty"`
+	NewBroken     []database.PageChange `json:"new_broken,omitempty"`
+}
+
+// Dispatcher delivers the events of finished crawl jobs to the webhooks. It
+// implements crawler.Notifier.
+type Dispatcher struct {
+	db      *database.DB
+	client  *http.Client
+	retries int
+	backoff time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a dispatcher for the webhooks stored in db.
+func New(db *database.DB) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		db:      db,
+		client:  &http.Client{Timeout: DefaultTimeout},
+		retries: DefaultRetries,
+		backoff: DefaultRetryBackoff,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// NewSecret returns a random webhook secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the value of the HeaderSignature header for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidEvent reports whether event is one of Events.
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ResumeDeliveries sends again in the background the deliveries that were
+// pending when the process stopped.
+func (d *Dispatcher) ResumeDeliveries() error {
+	deliveries, err := d.db.PendingDeliveries()
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		d.send(delivery)
+	}
+	return nil
+}
+
+// JobFinished records a delivery of the events of job to each subscribed
+// webhook and sends them in the background.
+func (d *Dispatcher) JobFinished(job database.CrawlJob) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if err := d.dispatch(job); err != nil {
+			log.Printf("Failed to notify webhooks of job %d: %v", job.ID, err)
+		}
+	}()
+}
+
+// Shutdown stops the deliveries in progress, leaving them pending so
+// ResumeDeliveries sends them on the next start, and waits for them to stop
+// or for ctx to be done.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries did not stop in time: %v", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) dispatch(job database.CrawlJob) error {
+	webhooks, err := d.db.GetWebhooks()
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	payloads, err := d.payloads(job)
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		for _, w := range webhooks {
+			if !w.Subscribed(payload.Event) {
+				continue
+			}
+			delivery := database.WebhookDelivery{
+				WebhookID: w.ID,
+				Event:     payload.Event,
+				JobID:     job.ID,
+				Payload:   body,
+				State:     database.DeliveryPending,
+			}
+			if delivery.ID, err = d.db.CreateDelivery(delivery); err != nil {
+				return err
+			}
+			d.send(delivery)
+		}
+	}
+	return nil
+}
+
+// payloads returns the events of a finished job.
+func (d *Dispatcher) payloads(job database.CrawlJob) ([]Payload, error) {
+	switch job.State {
+	case database.JobFailed:
+		return []Payload{{Event: EventJobFailed, Job: job}}, nil
+	case database.JobCompleted:
+	default:
+		return nil, nil
+	}
+
+	payloads := []Payload{{Event: EventJobCompleted, Job: job}}
+	prev, err := d.db.PreviousJob(job)
+	if errors.Is(err, database.ErrNotFound) {
+		return payloads, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	diff, err := d.db.DiffCrawls(prev.ID, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff.NewBroken) > 0 {
+		payloads = append(payloads, Payload{
+			Event:         EventNewBroken,
+			Job:           job,
+			PreviousJobID: prev.ID,
+			NewBroken:     diff.NewBroken,
+		})
+	}
+	return payloads, nil
+}
+
+// send delivers in the background, retrying failed requests with
+// exponential backoff, and records each attempt.
+func (d *Dispatcher) send(delivery database.WebhookDelivery) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		w, err := d.db.GetWebhook(delivery.WebhookID)
+		if err != nil {
+			log.Printf("Dropping delivery %d: %v", delivery.ID, err)
+			return
+		}
+
+		for {
+			status, err := d.post(w, delivery)
+			if d.ctx.Err() != nil {
+				// Left pending for the next start
+				return
+			}
+
+			now := time.Now()
+			delivery.Attempts++
+			delivery.LastAttemptAt = &now
+			delivery.StatusCode = status
+			delivery.Error = ""
+			switch {
+			case err == nil:
+				delivery.State = database.DeliveryDelivered
+			case delivery.Attempts > d.retries:
+				delivery.State = database.DeliveryFailed
+				delivery.Error = err.Error()
+			default:
+				delivery.Error = err.Error()
+			}
+			if err := d.db.UpdateDelivery(delivery); err != nil {
+				log.Printf("Failed to record delivery %d: %v", delivery.ID, err)
+			}
+			if delivery.State != database.DeliveryPending {
+				if err != nil {
+					log.Printf("Delivery %d of %s to %s failed: %v", delivery.ID, delivery.Event, w.URL, err)
+				}
+				return
+			}
+
+			delay := d.backoff << (delivery.Attempts - 1)
+			log.Printf("Delivery %d to %s failed, retrying in %s: %v", delivery.ID, w.URL, delay, err)
+			timer := time.NewTimer(delay)
+			select {
+			case <-d.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// post makes one delivery request and returns the response status, or 0
+// when no response was received. Responses other than 2xx are errors.
+func (d *Dispatcher) post(w *database.Webhook, delivery database.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, w.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"spiderlite/internal/database"
+)
+
+// request is a webhook request received by the test endpoint.
+type request struct {
+	event     string
+	signature string
+	payload   Payload
+	body      []byte
+}
+
+func TestDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	var received []request
+	seen := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/down":
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		case "/flaky":
+			// The first attempt of each delivery fails
+			if id := r.Header.Get(HeaderDelivery); !seen[id] {
+				seen[id] = true
+				http.Error(w, "busy", http.StatusInternalServerError)
+				return
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := request{event: r.Header.Get(HeaderEvent), signature: r.Header.Get(HeaderSignature), body: body}
+		if err := json.Unmarshal(body, &req.payload); err != nil {
+			t.Errorf("Invalid payload %s: %v", body, err)
+		}
+		received = append(received, req)
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	flaky, _ := db.CreateWebhook(database.Webhook{URL: ts.URL + "/flaky", Secret: "s3cret"})
+	failedOnly, _ := db.CreateWebhook(database.Webhook{URL: ts.URL + "/failed", Secret: "other", Events: []string{EventJobFailed}})
+	down, _ := db.CreateWebhook(database.Webhook{URL: ts.URL + "/down", Secret: "x", Events: []string{EventJobFailed}})
+
+	d := New(db)
+	d.backoff = time.Millisecond
+	finish := func(state string, pages ...database.PageData) database.CrawlJob {
+		jobID, err := db.CreateJob("https://example.com", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+		for _, page := range pages {
+			page.JobID, page.CrawledAt = jobID, time.Now()
+			if err := db.StorePage(page); err != nil {
+				t.Fatalf("StorePage() error = %v", err)
+			}
+		}
+		if err := db.FinishJob(jobID, state, "completed", ""); err != nil {
+			t.Fatalf("FinishJob() error = %v", err)
+		}
+		job, err := db.GetJob(jobID)
+		if err != nil {
+			t.Fatalf("GetJob() error = %v", err)
+		}
+		d.JobFinished(*job)
+		d.wg.Wait()
+		return *job
+	}
+
+	first := finish(database.JobCompleted, database.PageData{URL: "https://example.com/a", StatusCode: 200})
+	second := finish(database.JobCompleted, database.PageData{URL: "https://example.com/a", StatusCode: 404})
+	failed := finish(database.JobFailed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The deliveries of a job are sent concurrently
+	got := make(map[string]int)
+	var broken *Payload
+	for _, req := range received {
+		if req.event != req.payload.Event {
+			t.Errorf("Event header %s differs from payload event %s", req.event, req.payload.Event)
+		}
+		if req.signature != Sign("s3cret", req.body) && req.signature != Sign("other", req.body) {
+			t.Errorf("Unexpected signature %s", req.signature)
+		}
+		got[fmt.Sprintf("%s %d", req.event, req.payload.Job.ID)]++
+		if req.event == EventNewBroken {
+			broken = &req.payload
+		}
+	}
+	want := map[string]int{
+		fmt.Sprintf("%s %d", EventJobCompleted, first.ID):  1,
+		fmt.Sprintf("%s %d", EventJobCompleted, second.ID): 1,
+		fmt.Sprintf("%s %d", EventNewBroken, second.ID):    1,
+		fmt.Sprintf("%s %d", EventJobFailed, failed.ID):    2,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Received %v, want %v", got, want)
+	}
+	if broken == nil || broken.PreviousJobID != first.ID || len(broken.NewBroken) != 1 || broken.NewBroken[0].URL != "https://example.com/a" {
+		t.Errorf("Unexpected new broken payload %+v", broken)
+	}
+
+	deliveries, err := db.GetDeliveries(flaky)
+	if err != nil {
+		t.Fatalf("GetDeliveries() error = %v", err)
+	}
+	if len(deliveries) != 4 {
+		t.Fatalf("Expected 4 deliveries to the flaky webhook, got %d", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.State != database.DeliveryDelivered || delivery.Attempts != 2 || delivery.StatusCode != 200 {
+			t.Errorf("Expected delivery %d to succeed on its retry, got %+v", delivery.ID, delivery)
+		}
+	}
+	if deliveries, _ := db.GetDeliveries(failedOnly); len(deliveries) != 1 || deliveries[0].Event != EventJobFailed {
+		t.Errorf("Expected a single job.failed delivery, got %+v", deliveries)
+	}
+
+	deliveries, _ = db.GetDeliveries(down)
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery to the failing webhook, got %d", len(deliveries))
+	}
+	if d := deliveries[0]; d.State != database.DeliveryFailed || d.Attempts != DefaultRetries+1 || d.StatusCode != http.StatusServiceUnavailable || d.Error == "" {
+		t.Errorf("Expected the delivery to fail after its retries, got %+v", d)
+	}
+	if pending, _ := db.PendingDeliveries(); len(pending) != 0 {
+		t.Errorf("Expected no pending delivery, got %+v", pending)
+	}
+}
+
+func TestResumeDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, r.Header.Get(HeaderEvent))
+	}))
+	defer ts.Close()
+
+	db, err := database.NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	webhookID, _ := db.CreateWebhook(database.Webhook{URL: ts.URL, Secret: "s3cret"})
+	// A delivery left pending by a previous process
+	_, err = db.CreateDelivery(database.WebhookDelivery{WebhookID: webhookID, Event: EventJobFailed, Payload: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("CreateDelivery() error = %v", err)
+	}
+
+	d := New(db)
+	if err := d.ResumeDeliveries(); err != nil {
+		t.Fatalf("ResumeDeliveries() error = %v", err)
+	}
+	d.wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0] != EventJobFailed {
+		t.Errorf("Expected the pending delivery to be sent, got %v", events)
+	}
+	if pending, _ := db.PendingDeliveries(); len(pending) != 0 {
+		t.Errorf("Expected no pending delivery, got %+v", pending)
+	}
+}